@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"gitgub.com/cam-per/gossacks/gsc"
+	"github.com/urfave/cli/v3"
+)
+
+func openArchive(name string) (*gsc.Container, *os.File, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	container, err := gsc.NewContainer(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return container, f, nil
+}
+
+func requireArgs(cmd *cli.Command, n int) error {
+	if cmd.NArg() < n {
+		return fmt.Errorf("%s: expected %s", cmd.Name, cmd.ArgsUsage)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"io"
+
+	"github.com/urfave/cli/v3"
+)
+
+var catCommand = &cli.Command{
+	Name:      "cat",
+	Usage:     "write archive files to standard output",
+	ArgsUsage: "ARCHIVE FILE...",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{Name: "raw", Usage: "do not undo obfuscation"},
+	},
+	Action: runCat,
+}
+
+func runCat(ctx context.Context, cmd *cli.Command) error {
+	if err := requireArgs(cmd, 2); err != nil {
+		return err
+	}
+	container, f, err := openArchive(cmd.Args().First())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for _, name := range cmd.Args().Tail() {
+		var r io.ReadCloser
+		if cmd.Bool("raw") {
+			r, err = container.OpenRaw(name)
+		} else {
+			r, err = container.Open(name)
+		}
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(cmd.Root().Writer, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
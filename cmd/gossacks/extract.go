@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"gitgub.com/cam-per/gossacks/gsc"
+	"github.com/urfave/cli/v3"
+)
+
+var extractCommand = &cli.Command{
+	Name:      "extract",
+	Usage:     "extract the whole archive or the files matching glob patterns",
+	ArgsUsage: "ARCHIVE [PATTERN...]",
+	Flags: []cli.Flag{
+		&cli.StringFlag{Name: "output", Aliases: []string{"o"}, Value: ".", Usage: "destination `DIR`"},
+		&cli.BoolFlag{Name: "raw", Usage: "do not undo obfuscation"},
+		&cli.BoolFlag{Name: "verbose", Aliases: []string{"v"}, Usage: "print extracted paths"},
+	},
+	Action: runExtract,
+}
+
+func runExtract(ctx context.Context, cmd *cli.Command) error {
+	if err := requireArgs(cmd, 1); err != nil {
+		return err
+	}
+	container, f, err := openArchive(cmd.Args().First())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	patterns := cmd.Args().Tail()
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+
+	var roots []string
+	for _, pattern := range patterns {
+		matches, err := container.Glob(pattern)
+		if err != nil {
+			return err
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("%s: no matches", pattern)
+		}
+		roots = append(roots, matches...)
+	}
+
+	out := cmd.String("output")
+	for _, root := range roots {
+		err := fs.WalkDir(container, root, func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			if cmd.Bool("verbose") {
+				fmt.Fprintln(cmd.Root().Writer, name)
+			}
+			return extractFile(container, name, filepath.Join(out, filepath.FromSlash(name)), cmd.Bool("raw"))
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractFile(container *gsc.Container, name, dst string, raw bool) error {
+	var r io.ReadCloser
+	var err error
+	if raw {
+		r, err = container.OpenRaw(name)
+	} else {
+		r, err = container.Open(name)
+	}
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	w, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
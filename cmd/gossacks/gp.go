@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gitgub.com/cam-per/gossacks/gsc"
+	"gitgub.com/cam-per/gossacks/gsc/gp"
+	"gitgub.com/cam-per/gossacks/gsc/pal"
+	"github.com/urfave/cli/v3"
+)
+
+var gpCommand = &cli.Command{
+	Name:  "gp",
+	Usage: "work with GP sprite files",
+	Commands: []*cli.Command{
+		gpExportCommand,
+	},
+}
+
+var gpExportCommand = &cli.Command{
+	Name:      "export",
+	Usage:     "convert GP sprites to PNG frames, sprite sheets and animations",
+	ArgsUsage: "GP...",
+	Flags: []cli.Flag{
+		&cli.StringFlag{Name: "archive", Aliases: []string{"a"}, Usage: "read GP files and the palette from `ARCHIVE`"},
+		&cli.StringFlag{Name: "palette", Aliases: []string{"p"}, Required: true, Usage: "palette `FILE` (raw RGB, 6-bit VGA, JASC-PAL or RIFF PAL)"},
+		&cli.StringFlag{Name: "output", Aliases: []string{"o"}, Value: ".", Usage: "destination `DIR`, holding a directory per GP named after its relative path"},
+		&cli.BoolFlag{Name: "frames", Usage: "write one PNG per frame"},
+		&cli.BoolFlag{Name: "sheet", Usage: "write a packed sprite sheet with a JSON atlas"},
+		&cli.BoolFlag{Name: "gif", Usage: "write an animated GIF per sprite"},
+		&cli.BoolFlag{Name: "apng", Usage: "write an animated PNG per sprite"},
+		&cli.DurationFlag{Name: "delay", Value: 100 * time.Millisecond, Usage: "animation frame `DELAY`"},
+		&cli.IntFlag{Name: "sheet-width", Value: 2048, Usage: "maximum sprite sheet `WIDTH`"},
+		&cli.BoolFlag{Name: "strict", Usage: "fail on the first broken frame instead of skipping it"},
+	},
+	Action: runGpExport,
+}
+
+type gpSource struct {
+	container *gsc.Container
+}
+
+func (src *gpSource) open(name string) (io.ReadCloser, error) {
+	if src.container != nil {
+		if f, err := src.container.Open(name); err == nil {
+			return f, nil
+		}
+	}
+	return os.Open(name)
+}
+
+func (src *gpSource) glob(pattern string) ([]string, error) {
+	if src.container != nil {
+		return src.container.Glob(pattern)
+	}
+	return filepath.Glob(pattern)
+}
+
+func runGpExport(ctx context.Context, cmd *cli.Command) error {
+	if cmd.NArg() < 1 {
+		return fmt.Errorf("%s: expected %s", cmd.Name, cmd.ArgsUsage)
+	}
+
+	src := &gpSource{}
+	if name := cmd.String("archive"); name != "" {
+		container, f, err := openArchive(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		src.container = container
+	}
+
+	palette, err := loadPalette(src, cmd.String("palette"))
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for _, pattern := range cmd.Args().Slice() {
+		matches, err := src.glob(pattern)
+		if err != nil {
+			return err
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("%s: no matches", pattern)
+		}
+		names = append(names, matches...)
+	}
+
+	dirs := make(map[string]string)
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		dir := exportDir(cmd.String("output"), name)
+		if prev, ok := dirs[dir]; ok {
+			if prev == name {
+				continue
+			}
+			return fmt.Errorf("%s: output %s is already used by %s", name, dir, prev)
+		}
+		dirs[dir] = name
+		if err := exportGP(cmd, src, name, dir, palette); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// exportDir returns the directory the files exported from the GP file name
+// go to: its path without the extension under output, or only its base name
+// when the path is absolute or leaves the current directory.
+func exportDir(output, name string) string {
+	rel := filepath.FromSlash(strings.TrimSuffix(filepath.ToSlash(name), path.Ext(name)))
+	if !filepath.IsLocal(rel) {
+		rel = filepath.Base(rel)
+	}
+	return filepath.Join(output, rel)
+}
+
+func loadPalette(src *gpSource, name string) (color.Palette, error) {
+	r, err := src.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	palette, _, err := pal.NewDecoder(r).DecodeAuto()
+	return palette, err
+}
+
+func exportGP(cmd *cli.Command, src *gpSource, name, dir string, palette color.Palette) error {
+	r, err := src.open(name)
+	if err != nil {
+		return err
+	}
+	opts := []gp.Option{gp.WithPath(name)}
+	if cmd.Bool("strict") {
+		opts = append(opts, gp.WithStrict())
+	}
+	decoder, err := gp.NewDecoder(r, palette, opts...)
+	r.Close()
+	if err != nil {
+		return err
+	}
+	for _, problem := range decoder.Problems() {
+		fmt.Fprintln(cmd.Root().ErrWriter, "warning:", problem)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	frames, sheet, anim, apng := cmd.Bool("frames"), cmd.Bool("sheet"), cmd.Bool("gif"), cmd.Bool("apng")
+	if !frames && !sheet && !anim && !apng {
+		frames, sheet, anim, apng = true, true, true, true
+	}
+	delay := cmd.Duration("delay")
+
+	if sheet {
+		img, atlas := gp.NewSheet(decoder.Sprites, cmd.Int("sheet-width"))
+		if err := writePNG(filepath.Join(dir, "sheet.png"), img); err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(atlas, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, "sheet.json"), data, 0644); err != nil {
+			return err
+		}
+	}
+
+	for si := range decoder.Sprites {
+		sprite := &decoder.Sprites[si]
+		if len(sprite.Frames) == 0 || sprite.Rect().Empty() {
+			continue
+		}
+		if frames {
+			for fi, frame := range sprite.Frames {
+				if frame.Image == nil {
+					continue
+				}
+				name := filepath.Join(dir, fmt.Sprintf("sprite_%03d_frame_%03d.png", si, fi))
+				if err := writePNG(name, frame.Image); err != nil {
+					return err
+				}
+			}
+		}
+		if anim {
+			err := writeFile(filepath.Join(dir, fmt.Sprintf("sprite_%03d.gif", si)), func(w io.Writer) error {
+				return gp.EncodeGIF(w, sprite, palette, delay)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if apng {
+			err := writeFile(filepath.Join(dir, fmt.Sprintf("sprite_%03d.apng", si)), func(w io.Writer) error {
+				return gp.EncodeAPNG(w, sprite, delay)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func writePNG(name string, img image.Image) error {
+	return writeFile(name, func(w io.Writer) error { return png.Encode(w, img) })
+}
+
+func writeFile(name string, encode func(w io.Writer) error) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := encode(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
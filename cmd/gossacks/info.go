@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+
+	"gitgub.com/cam-per/gossacks/utils"
+	"github.com/urfave/cli/v3"
+)
+
+var infoCommand = &cli.Command{
+	Name:      "info",
+	Usage:     "print the archive header",
+	ArgsUsage: "ARCHIVE",
+	Action:    runInfo,
+}
+
+func runInfo(ctx context.Context, cmd *cli.Command) error {
+	if err := requireArgs(cmd, 1); err != nil {
+		return err
+	}
+	container, f, err := openArchive(cmd.Args().First())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	descriptor := container.Descriptor()
+	w := cmd.Root().Writer
+	fmt.Fprintf(w, "descriptor:  %s (%q)\n", hex.EncodeToString(descriptor[:]), utils.CString(descriptor[:]).String())
+	fmt.Fprintf(w, "version:     %d\n", container.Version())
+	fmt.Fprintf(w, "key:         0x%04x\n", container.Key())
+	fmt.Fprintf(w, "entries:     %d\n", container.Len())
+	fmt.Fprintf(w, "data offset: %d\n", container.DataOffset())
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+
+	"gitgub.com/cam-per/gossacks/gsc"
+	"github.com/urfave/cli/v3"
+)
+
+var lsCommand = &cli.Command{
+	Name:      "ls",
+	Usage:     "list archive contents",
+	ArgsUsage: "ARCHIVE [DIR]",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{Name: "long", Aliases: []string{"l"}, Usage: "show type, size, hash and obfuscation flag"},
+		&cli.BoolFlag{Name: "recursive", Aliases: []string{"R"}, Usage: "list subdirectories recursively"},
+		&cli.BoolFlag{Name: "tree", Aliases: []string{"t"}, Usage: "print the listing as a tree"},
+	},
+	Action: runLs,
+}
+
+func runLs(ctx context.Context, cmd *cli.Command) error {
+	if err := requireArgs(cmd, 1); err != nil {
+		return err
+	}
+	container, f, err := openArchive(cmd.Args().First())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dir := "."
+	if cmd.NArg() > 1 {
+		dir = cmd.Args().Get(1)
+	}
+	info, err := container.Stat(dir)
+	if err != nil {
+		return err
+	}
+
+	w := cmd.Root().Writer
+	long := cmd.Bool("long")
+	switch {
+	case !info.IsDir():
+		printEntry(w, dir, info.(gsc.Entry), long)
+		return nil
+	case cmd.Bool("tree"):
+		fmt.Fprintln(w, dir)
+		return printTree(w, container, dir, "", long)
+	case cmd.Bool("recursive"):
+		return fs.WalkDir(container, dir, func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if name == dir {
+				return nil
+			}
+			printEntry(w, name, d.(gsc.Entry), long)
+			return nil
+		})
+	}
+
+	entries, err := container.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		printEntry(w, e.Name(), e.(gsc.Entry), long)
+	}
+	return nil
+}
+
+func printEntry(w io.Writer, name string, e gsc.Entry, long bool) {
+	if !long {
+		fmt.Fprintln(w, name)
+		return
+	}
+	fmt.Fprintf(w, "%s %10d %8s %s %s\n", entryType(e), e.Size(), entryHash(e), entryFlag(e), name)
+}
+
+func printTree(w io.Writer, container *gsc.Container, dir, prefix string, long bool) error {
+	entries, err := container.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for i, d := range entries {
+		branch, indent := "├── ", "│   "
+		if i == len(entries)-1 {
+			branch, indent = "└── ", "    "
+		}
+		e := d.(gsc.Entry)
+		if long && !e.IsDir() {
+			fmt.Fprintf(w, "%s%s%s (%d bytes, %s, %s)\n", prefix, branch, e.Name(), e.Size(), entryHash(e), entryFlag(e))
+		} else {
+			fmt.Fprintf(w, "%s%s%s\n", prefix, branch, e.Name())
+		}
+		if e.IsDir() {
+			if err := printTree(w, container, path.Join(dir, e.Name()), prefix+indent, long); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func entryType(e gsc.Entry) string {
+	if e.IsDir() {
+		return "d"
+	}
+	return "-"
+}
+
+func entryHash(e gsc.Entry) string {
+	if e.IsDir() {
+		return "-"
+	}
+	return e.Hash()
+}
+
+func entryFlag(e gsc.Entry) string {
+	if e.Obfuscated() {
+		return "x"
+	}
+	return "-"
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/urfave/cli/v3"
+)
+
+func main() {
+	os.Exit(runApp(context.Background(), os.Args, os.Stdout, os.Stderr))
+}
+
+// runApp runs the command line args and returns the exit status.
+func runApp(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	app := newApp()
+	app.Writer, app.ErrWriter = stdout, stderr
+	if err := app.Run(ctx, args); err != nil {
+		fmt.Fprintln(stderr, "gossacks:", err)
+		return 1
+	}
+	return 0
+}
+
+func newApp() *cli.Command {
+	return &cli.Command{
+		Name:  "gossacks",
+		Usage: "inspect and build Cossacks .gsc archives",
+		Commands: []*cli.Command{
+			lsCommand,
+			catCommand,
+			extractCommand,
+			packCommand,
+			infoCommand,
+			gpCommand,
+		},
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"gitgub.com/cam-per/gossacks/gsc"
+	"gitgub.com/cam-per/gossacks/gsc/gp"
+	"gitgub.com/cam-per/gossacks/gsc/pal"
+)
+
+// run runs gossacks with args and returns what it wrote and its exit
+// status.
+func run(t *testing.T, args ...string) (stdout, stderr string, status int) {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	status = runApp(context.Background(), append([]string{"gossacks"}, args...), &out, &errOut)
+	return out.String(), errOut.String(), status
+}
+
+// mustRun is like run but fails the test unless gossacks succeeds.
+func mustRun(t *testing.T, args ...string) string {
+	t.Helper()
+	out, errOut, status := run(t, args...)
+	if status != 0 {
+		t.Fatalf("gossacks %s: exit status %d: %s", strings.Join(args, " "), status, errOut)
+	}
+	return out
+}
+
+// fail runs gossacks with args and fails the test unless it exits with
+// status 1 and reports an error.
+func fail(t *testing.T, args ...string) {
+	t.Helper()
+	_, errOut, status := run(t, args...)
+	if status != 1 || !strings.HasPrefix(errOut, "gossacks: ") {
+		t.Fatalf("gossacks %s: exit status %d, stderr %q; want status 1 and an error", strings.Join(args, " "), status, errOut)
+	}
+}
+
+var packFiles = map[string]string{
+	"readme.txt":       "hello",
+	"gp/units/pik.gp":  "pikeman",
+	"gp/units/musk.gp": "musketeer",
+	"pal/agew_1.pal":   "palette",
+}
+
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := fs.WalkDir(os.DirFS(dir), ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		files[name] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestPackExtract(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeTree(t, src, packFiles)
+
+	// The archive is written inside the tree it packs.
+	archive := filepath.Join(src, "out.gsc")
+	mustRun(t, "pack", "-o", archive, "--obfuscate", "gp/units/*", src)
+	mustRun(t, "extract", "-o", dst, archive)
+
+	got := readTree(t, dst)
+	if len(got) != len(packFiles) {
+		t.Fatalf("extracted %v, want %v", got, packFiles)
+	}
+	for name, want := range packFiles {
+		if got[name] != want {
+			t.Errorf("%s = %q, want %q", name, got[name], want)
+		}
+	}
+
+	// Repacking over the existing archive still leaves it out.
+	mustRun(t, "pack", "-o", archive, src)
+	fail(t, "extract", "-o", t.TempDir(), archive, "out.gsc")
+}
+
+func TestPackFailureLeavesNoOutput(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "out.gsc")
+	fail(t, "pack", "-o", archive, filepath.Join(dir, "missing"))
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("left %v behind", entries)
+	}
+}
+
+// writeArchive packs files into an archive in a temporary directory,
+// obfuscating the units, and returns its path.
+func writeArchive(t *testing.T, files map[string]string) string {
+	t.Helper()
+	fsys := fstest.MapFS{}
+	for name, data := range files {
+		fsys[name] = &fstest.MapFile{Data: []byte(data)}
+	}
+	name := filepath.Join(t.TempDir(), "test.gsc")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	err = gsc.Build(fsys, f, &gsc.WriterOptions{
+		Descriptor: [6]byte{'G', 'S', 'C'},
+		Version:    2,
+		Key:        0x1234,
+		Obfuscate:  func(name string) bool { return strings.HasPrefix(name, "gp/units/") },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestLs(t *testing.T) {
+	archive := writeArchive(t, packFiles)
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{nil, "gp\npal\nreadme.txt\n"},
+		{[]string{"gp/units"}, "musk.gp\npik.gp\n"},
+		{[]string{"readme.txt"}, "readme.txt\n"},
+		{[]string{"-l", "gp/units"}, "" +
+			"-          9 00000000 x musk.gp\n" +
+			"-          7 00000000 x pik.gp\n"},
+		{[]string{"-l", "pal"}, "-          7 00000000 - agew_1.pal\n"},
+		{[]string{"-R"}, "" +
+			"gp\n" +
+			"gp/units\n" +
+			"gp/units/musk.gp\n" +
+			"gp/units/pik.gp\n" +
+			"pal\n" +
+			"pal/agew_1.pal\n" +
+			"readme.txt\n"},
+		{[]string{"-R", "-l", "gp"}, "" +
+			"d          0        - - gp/units\n" +
+			"-          9 00000000 x gp/units/musk.gp\n" +
+			"-          7 00000000 x gp/units/pik.gp\n"},
+		{[]string{"-t"}, "" +
+			".\n" +
+			"├── gp\n" +
+			"│   └── units\n" +
+			"│       ├── musk.gp\n" +
+			"│       └── pik.gp\n" +
+			"├── pal\n" +
+			"│   └── agew_1.pal\n" +
+			"└── readme.txt\n"},
+		{[]string{"-t", "-l", "pal"}, "" +
+			"pal\n" +
+			"└── agew_1.pal (7 bytes, 00000000, -)\n"},
+	} {
+		args := append([]string{"ls", archive}, tc.args...)
+		if got := mustRun(t, args...); got != tc.want {
+			t.Errorf("ls %s:\n%s\nwant:\n%s", strings.Join(tc.args, " "), got, tc.want)
+		}
+	}
+
+	fail(t, "ls")
+	fail(t, "ls", archive, "missing")
+	fail(t, "ls", filepath.Join(t.TempDir(), "missing.gsc"))
+}
+
+func TestCat(t *testing.T) {
+	archive := writeArchive(t, packFiles)
+	if got := mustRun(t, "cat", archive, "readme.txt", "gp/units/pik.gp"); got != "hellopikeman" {
+		t.Errorf("cat = %q, want %q", got, "hellopikeman")
+	}
+
+	raw := []byte(packFiles["gp/units/pik.gp"])
+	for i := range raw {
+		raw[i] ^= 0x78
+	}
+	if got := mustRun(t, "cat", "--raw", archive, "gp/units/pik.gp"); got != string(raw) {
+		t.Errorf("cat --raw = %q, want %q", got, raw)
+	}
+	if got := mustRun(t, "cat", "--raw", archive, "readme.txt"); got != "hello" {
+		t.Errorf("cat --raw of a plain entry = %q, want %q", got, "hello")
+	}
+
+	fail(t, "cat", archive)
+	fail(t, "cat", archive, "missing")
+	fail(t, "cat", archive, "gp")
+}
+
+func TestInfo(t *testing.T) {
+	archive := writeArchive(t, packFiles)
+	want := "" +
+		"descriptor:  475343000000 (\"GSC\")\n" +
+		"version:     2\n" +
+		"key:         0x1234\n" +
+		"entries:     4\n" +
+		"data offset: 338\n"
+	if got := mustRun(t, "info", archive); got != want {
+		t.Errorf("info:\n%s\nwant:\n%s", got, want)
+	}
+
+	fail(t, "info")
+	fail(t, "info", filepath.Join(t.TempDir(), "missing.gsc"))
+}
+
+// gpFile returns a GP file with one sprite of two frames drawn in palette.
+func gpFile(t *testing.T, palette color.Palette) []byte {
+	t.Helper()
+	var frames []*gp.Frame
+	for i := range 2 {
+		img := image.NewPaletted(image.Rect(0, 0, 3, 2), palette)
+		for j := range img.Pix {
+			img.Pix[j] = uint8(1 + i + j)
+		}
+		frames = append(frames, gp.NewFrame(img, image.Pt(i, 0)))
+	}
+	var buf bytes.Buffer
+	if err := gp.NewEncoder(&buf, palette).Encode([]gp.Sprite{{Frames: frames}}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func exportPalette() color.Palette {
+	palette := make(color.Palette, 256)
+	for i := range palette {
+		palette[i] = color.RGBA{uint8(i), 0xff - uint8(i), 0x80, 0xff}
+	}
+	return palette
+}
+
+func TestGpExport(t *testing.T) {
+	palette := exportPalette()
+	src, dst := t.TempDir(), t.TempDir()
+	writeTree(t, src, map[string]string{
+		"unit.gp":   string(gpFile(t, palette)),
+		"game.pal":  string(pal.RGB(palette)),
+		"broken.gp": "not a sprite",
+	})
+
+	if out := mustRun(t, "gp", "export", "-p", filepath.Join(src, "game.pal"), "-o", dst, filepath.Join(src, "unit.gp")); out != "" {
+		t.Errorf("gp export wrote %q", out)
+	}
+	var got []string
+	for name := range readTree(t, dst) {
+		got = append(got, name)
+	}
+	slices.Sort(got)
+	want := []string{
+		"unit/sheet.json",
+		"unit/sheet.png",
+		"unit/sprite_000.apng",
+		"unit/sprite_000.gif",
+		"unit/sprite_000_frame_000.png",
+		"unit/sprite_000_frame_001.png",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("gp export wrote %v, want %v", got, want)
+	}
+
+	f, err := os.Open(filepath.Join(dst, "unit", "sprite_000_frame_001.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := image.Rect(0, 0, 3, 2); img.Bounds() != want {
+		t.Errorf("frame bounds = %v, want %v", img.Bounds(), want)
+	}
+	if c := color.RGBAModel.Convert(img.At(0, 0)); c != palette[2] {
+		t.Errorf("first pixel = %v, want %v", c, palette[2])
+	}
+
+	fail(t, "gp", "export", "-o", dst, filepath.Join(src, "unit.gp"))
+	fail(t, "gp", "export", "-p", filepath.Join(src, "game.pal"), "-o", dst, filepath.Join(src, "missing*.gp"))
+	fail(t, "gp", "export", "-p", filepath.Join(src, "game.pal"), "-o", dst, "--strict", filepath.Join(src, "broken.gp"))
+}
+
+func TestGpExportNames(t *testing.T) {
+	palette := exportPalette()
+	sprite := string(gpFile(t, palette))
+	archive := writeArchive(t, map[string]string{
+		"gp/units/a.gp":     sprite,
+		"gp/buildings/a.gp": sprite,
+		"pal/game.pal":      string(pal.RGB(palette)),
+	})
+
+	// Files sharing a base name keep their directories apart.
+	dst := t.TempDir()
+	mustRun(t, "gp", "export", "-a", archive, "-p", "pal/game.pal", "-o", dst, "--frames", "gp/*/a.gp", "gp/units/*.gp")
+	var got []string
+	for name := range readTree(t, dst) {
+		got = append(got, name)
+	}
+	slices.Sort(got)
+	want := []string{
+		"gp/buildings/a/sprite_000_frame_000.png",
+		"gp/buildings/a/sprite_000_frame_001.png",
+		"gp/units/a/sprite_000_frame_000.png",
+		"gp/units/a/sprite_000_frame_001.png",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("gp export wrote %v, want %v", got, want)
+	}
+
+	// Absolute paths only keep their base names, which must not collide.
+	src := t.TempDir()
+	writeTree(t, src, map[string]string{
+		"game.pal": string(pal.RGB(palette)),
+		"one/a.gp": sprite,
+		"two/a.gp": sprite,
+	})
+	fail(t, "gp", "export", "-p", filepath.Join(src, "game.pal"), "-o", t.TempDir(), filepath.Join(src, "*", "a.gp"))
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gitgub.com/cam-per/gossacks/gsc"
+	"github.com/urfave/cli/v3"
+)
+
+var packCommand = &cli.Command{
+	Name:      "pack",
+	Usage:     "build an archive from a directory tree",
+	ArgsUsage: "DIR",
+	Flags: []cli.Flag{
+		&cli.StringFlag{Name: "output", Aliases: []string{"o"}, Required: true, Usage: "archive `FILE` to create"},
+		&cli.StringFlag{Name: "template", Usage: "copy descriptor, version and key from `ARCHIVE`"},
+		&cli.StringSliceFlag{Name: "obfuscate", Usage: "obfuscate files matching `PATTERN`"},
+	},
+	Action: runPack,
+}
+
+func runPack(ctx context.Context, cmd *cli.Command) error {
+	if err := requireArgs(cmd, 1); err != nil {
+		return err
+	}
+
+	opts := &gsc.WriterOptions{}
+	if name := cmd.String("template"); name != "" {
+		template, f, err := openArchive(name)
+		if err != nil {
+			return err
+		}
+		opts.Descriptor = template.Descriptor()
+		opts.Version = template.Version()
+		opts.Key = template.Key()
+		f.Close()
+	}
+	if patterns := cmd.StringSlice("obfuscate"); len(patterns) > 0 {
+		opts.Obfuscate = func(name string) bool {
+			name = strings.ToLower(name)
+			for _, pattern := range patterns {
+				if ok, _ := path.Match(strings.ToLower(pattern), name); ok {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	dir, output := cmd.Args().First(), cmd.String("output")
+	// Write next to the output so the rename cannot cross file systems, and
+	// leave nothing behind on failure.
+	tmp, err := os.CreateTemp(filepath.Dir(output), "."+filepath.Base(output)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	// The output may lie inside the tree being packed; don't pack it.
+	skip := make(map[string]bool)
+	for _, name := range []string{output, tmp.Name()} {
+		if rel, ok := within(dir, name); ok {
+			skip[rel] = true
+		}
+	}
+
+	fsys := os.DirFS(dir)
+	w := bufio.NewWriter(tmp)
+	writer := gsc.NewWriter(w, opts)
+	err = fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || skip[name] {
+			return nil
+		}
+		var flags uint8
+		if opts.Obfuscate != nil && opts.Obfuscate(name) {
+			flags = gsc.FlagObfuscated
+		}
+		return writer.AddFile(fsys, name, flags)
+	})
+	if err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), output)
+}
+
+// within returns name as a slash-separated path relative to dir when it lies
+// inside dir.
+func within(dir, name string) (string, bool) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	absName, err := filepath.Abs(name)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(absDir, absName)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
@@ -2,10 +2,13 @@ module gitgub.com/cam-per/gossacks
 
 go 1.24.4
 
+require (
+	github.com/go-gl/gl v0.0.0-20231021071112-07e5d0ea2e71
+	github.com/urfave/cli/v3 v3.4.1
+	golang.org/x/text v0.29.0
+)
+
 require (
 	github.com/dustin/go-humanize v1.0.1 // indirect
-	github.com/go-gl/gl v0.0.0-20231021071112-07e5d0ea2e71 // indirect
 	github.com/go-gl/glfw/v3.3/glfw v0.0.0-20250301202403-da16c1255728 // indirect
-	github.com/urfave/cli/v3 v3.4.1 // indirect
-	golang.org/x/text v0.29.0 // indirect
 )
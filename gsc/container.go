@@ -3,10 +3,11 @@ package gsc
 import (
 	"encoding/binary"
 	"encoding/hex"
+	"fmt"
 	"io"
 	"io/fs"
-	"os"
 	"path"
+	"sort"
 	"strings"
 	"time"
 
@@ -29,11 +30,15 @@ type header struct {
 
 type Entry interface {
 	fs.DirEntry
-	fs.File
 	fs.FileInfo
+	// Deprecated: entries are not open files. Open them with Container.Open,
+	// whose handles implement fs.File and, for directories, fs.ReadDirFile.
+	fs.File
+	// Deprecated: see fs.File above.
 	fs.ReadDirFile
 	Hash() string
 	Path() string
+	Obfuscated() bool
 }
 
 type entry struct {
@@ -43,7 +48,6 @@ type entry struct {
 	header  *header
 	entries []fs.DirEntry
 	m       map[string]*entry
-	ep      int
 }
 
 func newDirEntry(path string, name string) *entry {
@@ -69,17 +73,12 @@ func newFileEntry(path string, name string, h *header) *entry {
 func (e *entry) Name() string               { return e.name }
 func (e *entry) IsDir() bool                { return e.isDir }
 func (e *entry) Info() (fs.FileInfo, error) { return e, nil }
-func (e *entry) Stat() (fs.FileInfo, error) { return e, nil }
 func (e *entry) Path() string               { return e.path }
 func (e *entry) ModTime() time.Time         { return time.Time{} }
 func (e *entry) Sys() any                   { return nil }
 
 func (e *entry) Type() fs.FileMode {
-	if e.isDir {
-		return os.ModeDir
-	} else {
-		return os.ModePerm
-	}
+	return e.Mode().Type()
 }
 
 func (e *entry) Size() int64 {
@@ -91,29 +90,12 @@ func (e *entry) Size() int64 {
 
 func (e *entry) Mode() fs.FileMode {
 	if e.isDir {
-		return os.ModeDir
+		return fs.ModeDir | 0555
 	} else {
-		return os.ModePerm
+		return 0444
 	}
 }
 
-func (e *entry) ReadDir(n int) ([]fs.DirEntry, error) {
-	if len(e.entries) == 0 {
-		return nil, nil
-	}
-	start := e.ep
-	if n <= 0 {
-		n = len(e.entries)
-		e.ep = n
-	} else {
-		e.ep += n
-	}
-	if e.ep > len(e.entries) {
-		e.ep = len(e.entries)
-	}
-	return e.entries[start:e.ep], nil
-}
-
 func (e *entry) Hash() string {
 	if e.header == nil {
 		return ""
@@ -121,6 +103,42 @@ func (e *entry) Hash() string {
 	return hex.EncodeToString(e.header.Hash[:])
 }
 
+func (e *entry) Obfuscated() bool {
+	return e.header != nil && e.header.Flags > 0
+}
+
+// Stat returns the entry itself.
+//
+// Deprecated: use Container.Stat or the Stat method of an opened file.
+func (e *entry) Stat() (fs.FileInfo, error) { return e, nil }
+
+// Read fails: an entry holds no reader.
+//
+// Deprecated: read the file opened with Container.Open.
+func (e *entry) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: e.path, Err: errNotOpen}
+}
+
+// Close does nothing.
+//
+// Deprecated: close the file opened with Container.Open.
+func (e *entry) Close() error { return nil }
+
+// ReadDir returns the first n entries of the directory, or all of them when
+// n <= 0. Unlike fs.ReadDirFile it keeps no cursor, as entries are shared.
+//
+// Deprecated: use Container.ReadDir or the ReadDir method of an opened
+// directory.
+func (e *entry) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !e.isDir {
+		return nil, &fs.PathError{Op: "readdir", Path: e.path, Err: errNotDir}
+	}
+	if n <= 0 || n > len(e.entries) {
+		n = len(e.entries)
+	}
+	return append([]fs.DirEntry(nil), e.entries[:n]...), nil
+}
+
 func (e *entry) exists(name string) bool {
 	_, ok := e.m[name]
 	return ok
@@ -143,29 +161,45 @@ func (e *entry) add(item *entry) {
 	e.m[item.Name()] = item
 }
 
+func (e *entry) sort() {
+	sort.Slice(e.entries, func(i, j int) bool { return e.entries[i].Name() < e.entries[j].Name() })
+	for _, item := range e.m {
+		if item.isDir {
+			item.sort()
+		}
+	}
+}
+
 type Reader interface {
 	io.Reader
 	io.ReaderAt
 }
 
+type archiveHeader struct {
+	Descriptor [6]byte
+	Version    uint16
+	Key        uint16
+	Entries    uint32
+}
+
+// Container is a GSC archive opened as an fs.FS. Once created it is safe for
+// concurrent use, provided concurrent ReadAt calls on its Reader are, as they
+// are for bytes.Reader and os.File.
 type Container struct {
-	header struct {
-		Descriptor [6]byte
-		Version    uint16
-		Key        uint16
-		Entries    uint32
-	}
+	header     archiveHeader
 	r          Reader
 	fat        []header
 	fm         map[string]*entry
 	root       *entry
 	dataOffset int64
+	size       int64
 }
 
 func NewContainer(r Reader) (*Container, error) {
 	container := &Container{
 		r:    r,
-		root: newDirEntry("/", ""),
+		root: newDirEntry(".", "."),
+		size: readerSize(r),
 	}
 	if err := container.readHeader(); err != nil {
 		return nil, err
@@ -176,60 +210,245 @@ func NewContainer(r Reader) (*Container, error) {
 	return container, nil
 }
 
-func (container *Container) Name() string                         { return container.root.Name() }
-func (container *Container) IsDir() bool                          { return true }
-func (container *Container) Type() fs.FileMode                    { return os.ModeDir }
-func (container *Container) Info() (fs.FileInfo, error)           { return container.root.Info() }
-func (container *Container) Stat() (fs.FileInfo, error)           { return container.root.Stat() }
-func (container *Container) ReadDir(n int) ([]fs.DirEntry, error) { return container.root.ReadDir(n) }
+func (container *Container) Descriptor() [6]byte { return container.header.Descriptor }
+func (container *Container) Version() uint16     { return container.header.Version }
+func (container *Container) Key() uint16         { return container.header.Key }
+func (container *Container) Len() int            { return len(container.fat) }
+func (container *Container) DataOffset() int64   { return container.dataOffset }
+
+// The methods below made the container its own root directory entry before
+// it became an fs.FS. Stat and ReadDir could not be kept: they now take a
+// name, as fs.StatFS and fs.ReadDirFS require.
+
+// Deprecated: use Stat(".").
+func (container *Container) Name() string { return container.root.Name() }
+
+// Deprecated: a container is always a directory.
+func (container *Container) IsDir() bool { return true }
+
+// Deprecated: use Stat(".").
+func (container *Container) Type() fs.FileMode { return container.root.Type() }
+
+// Deprecated: use Stat(".").
+func (container *Container) Info() (fs.FileInfo, error) { return container.root, nil }
+
+// WriteTo repacks the container through a Writer using its own header and
+// entries. Archives whose data is stored contiguously in FAT order come out
+// byte-identical.
+func (container *Container) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	writer := NewWriter(cw, &WriterOptions{
+		Descriptor: container.header.Descriptor,
+		Version:    container.header.Version,
+		Key:        container.header.Key,
+	})
+	if err := writer.AddContainer(container); err != nil {
+		return cw.n, err
+	}
+	err := writer.Close()
+	return cw.n, err
+}
+
+// File is an open archive entry. Reads through every method are
+// de-obfuscated unless the file was opened with OpenRaw.
+type File interface {
+	fs.File
+	io.ReaderAt
+	io.Seeker
+}
 
 type openedFile struct {
 	*entry
-	sr *io.SectionReader
+	sr  *io.SectionReader
+	raw bool
 }
 
-func (f *openedFile) ReadAt(p []byte, off int64) (n int, err error) {
-	n, err = f.sr.ReadAt(p, off)
-	if err != nil {
-		return
+func (f *openedFile) decode(p []byte) {
+	if !f.raw && f.header.Flags > 0 {
+		obfuscate(p)
 	}
-	return
+}
+
+func (f *openedFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := f.sr.ReadAt(p, off)
+	f.decode(p[:n])
+	return n, err
 }
 
 func (f *openedFile) Read(p []byte) (int, error) {
 	n, err := f.sr.Read(p)
-	if f.header.Flags > 0 {
-		for i := 0; i < n; i++ {
-			p[i] = ^p[i] ^ (^key)
-		}
-	}
+	f.decode(p[:n])
 	return n, err
 }
 
+func (f *openedFile) Seek(offset int64, whence int) (int64, error) {
+	return f.sr.Seek(offset, whence)
+}
+
+func (f *openedFile) ReadDir(int) ([]fs.DirEntry, error) {
+	return nil, &fs.PathError{Op: "readdir", Path: f.path, Err: errNotDir}
+}
+
 func (f *openedFile) Close() error               { return nil }
 func (f *openedFile) Stat() (fs.FileInfo, error) { return f.entry, nil }
 
-func (container *Container) Open(name string) (fs.File, error) {
-	name = strings.ToLower(name)
-	file, ok := container.fm[name]
+type openedDir struct {
+	*entry
+	offset int
+}
+
+func (d *openedDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.path, Err: errIsDir}
+}
+
+func (d *openedDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	return readDirAt(d.entries, &d.offset, n)
+}
+
+func (d *openedDir) Close() error               { return nil }
+func (d *openedDir) Stat() (fs.FileInfo, error) { return d.entry, nil }
+
+func obfuscate(p []byte) {
+	for i := range p {
+		p[i] = ^p[i] ^ (^key)
+	}
+}
+
+func (container *Container) lookup(op, name string) (*entry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	e, ok := container.fm[strings.ToLower(name)]
 	if !ok {
-		return nil, os.ErrNotExist
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return e, nil
+}
+
+func (container *Container) Open(name string) (fs.File, error) {
+	file, err := container.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if file.IsDir() {
+		return &openedDir{entry: file}, nil
+	}
+	return container.openFile(file, false), nil
+}
+
+// OpenRaw opens the file name and returns its bytes exactly as stored in the
+// archive, without undoing the obfuscation.
+func (container *Container) OpenRaw(name string) (File, error) {
+	file, err := container.lookup("open", name)
+	if err != nil {
+		return nil, err
 	}
 	if file.IsDir() {
-		return &openedFile{entry: file}, nil
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errIsDir}
 	}
+	return container.openFile(file, true), nil
+}
+
+func (container *Container) openFile(file *entry, raw bool) *openedFile {
 	sr := io.NewSectionReader(container.r, container.dataOffset+int64(file.header.Offset), int64(file.header.Size))
-	return &openedFile{entry: file, sr: sr}, nil
+	return &openedFile{entry: file, sr: sr, raw: raw}
+}
+
+func (container *Container) Stat(name string) (fs.FileInfo, error) {
+	e, err := container.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (container *Container) ReadDir(name string) ([]fs.DirEntry, error) {
+	e, err := container.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !e.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+	return append([]fs.DirEntry(nil), e.entries...), nil
+}
+
+func (container *Container) ReadFile(name string) ([]byte, error) {
+	f, err := container.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	file, ok := f.(*openedFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errIsDir}
+	}
+	// Sizes come from the file table; don't allocate past the archive end,
+	// nor up front when it is unknown.
+	if container.size < 0 {
+		buf, err := io.ReadAll(f)
+		if err == nil && int64(len(buf)) < file.Size() {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+		}
+		return buf, nil
+	}
+	if container.dataOffset+int64(file.header.Offset)+file.Size() > container.size {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: io.ErrUnexpectedEOF}
+	}
+	buf := make([]byte, file.Size())
+	if _, err := io.ReadFull(f, buf); err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	return buf, nil
+}
+
+func (container *Container) Glob(pattern string) ([]string, error) {
+	return globFold(pattern, container.ReadDir)
+}
+
+func (container *Container) Sub(dir string) (fs.FS, error) {
+	e, err := container.lookup("sub", dir)
+	if err != nil {
+		return nil, err
+	}
+	if !e.IsDir() {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: errNotDir}
+	}
+	if dir == "." {
+		return container, nil
+	}
+	return &subContainer{container: container, dir: e.path}, nil
 }
 
 func (container *Container) readHeader() error {
-	return binary.Read(container.r, binary.LittleEndian, &container.header)
+	if err := binary.Read(container.r, binary.LittleEndian, &container.header); err != nil {
+		return NewDecodeError("gsc", "reading archive header", err).At(0)
+	}
+	return nil
 }
 
+// maxEntries bounds the file table of archives whose size is unknown, which
+// is otherwise allocated on the word of their header alone.
+const maxEntries = 1 << 18
+
 func (container *Container) readFAT() error {
+	// Check the entry count against the archive size before allocating for it.
+	fatOffset := int64(binary.Size(container.header))
+	fatSize := int64(container.header.Entries) * int64(binary.Size(header{}))
+	if container.size >= 0 && fatOffset+fatSize > container.size {
+		reason := fmt.Sprintf("file table of %d entries past the end of the archive", container.header.Entries)
+		return NewDecodeError("gsc", reason, io.ErrUnexpectedEOF).At(fatOffset)
+	}
+	if container.size < 0 && container.header.Entries > maxEntries {
+		reason := fmt.Sprintf("file table of %d entries, more than %d", container.header.Entries, maxEntries)
+		return NewDecodeError("gsc", reason, nil).At(fatOffset)
+	}
 	container.fat = make([]header, container.header.Entries)
 	if err := binary.Read(container.r, binary.LittleEndian, &container.fat); err != nil {
-		return err
+		return NewDecodeError("gsc", "reading file table", err).At(fatOffset)
 	}
 	container.dataOffset = int64(binary.Size(container.header) + binary.Size(container.fat))
 
@@ -238,30 +457,41 @@ func (container *Container) readFAT() error {
 	}
 
 	container.fm = map[string]*entry{
-		"/": container.root,
+		".": container.root,
 	}
 	for i, v := range container.fat {
-		a := utils.CString(v.Name[:]).Decode(charmap.CodePage866)
-		a = "/" + strings.ReplaceAll(a, "\\", "/")
-		a = strings.ToLower(a)
-		name := path.Base(a)
-		container.createFile(a, newFileEntry(a, name, &container.fat[i]))
+		a := fatPath(v.Name)
+		if a == "" {
+			continue
+		}
+		container.createFile(a, newFileEntry(a, path.Base(a), &container.fat[i]))
 	}
+	container.root.sort()
 	return nil
 }
 
+func fatPath(raw [64]byte) string {
+	a := utils.CString(raw[:]).Decode(charmap.CodePage866)
+	a = path.Clean("/" + strings.ReplaceAll(a, "\\", "/"))
+	return strings.ToLower(a[1:])
+}
+
 func (container *Container) createFile(path string, e *entry) {
+	if _, ok := container.fm[path]; ok {
+		return
+	}
 	container.fm[path] = e
 	parts := strings.Split(path, "/")
 	pwd := container.root
 	for i, part := range parts {
-		if i == 0 {
-			continue
-		}
 		if i == len(parts)-1 {
 			pwd.add(e)
 			break
 		}
+		if v, ok := pwd.m[part]; ok && !v.isDir {
+			delete(container.fm, path)
+			return
+		}
 		pwd = pwd.makeDir(part)
 		container.fm[pwd.Path()] = pwd
 	}
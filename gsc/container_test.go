@@ -0,0 +1,274 @@
+package gsc_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"gitgub.com/cam-per/gossacks/gsc"
+)
+
+func newTestContainer(t testing.TB, files fstest.MapFS, opts *gsc.WriterOptions) *gsc.Container {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := gsc.Build(files, &buf, opts); err != nil {
+		t.Fatal(err)
+	}
+	container, err := gsc.NewContainer(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return container
+}
+
+var testFiles = fstest.MapFS{
+	"readme.txt":       {Data: []byte("hello")},
+	"gp/units/pik.gp":  {Data: bytes.Repeat([]byte{1, 2, 3}, 100)},
+	"gp/units/musk.gp": {Data: []byte("musketeer")},
+	"gp/empty.gp":      {Data: nil},
+	"pal/agew_1.pal":   {Data: bytes.Repeat([]byte{0x7f}, 768)},
+}
+
+func obfuscateUnits(name string) bool { return strings.HasPrefix(name, "gp/units/") }
+
+func TestContainerFS(t *testing.T) {
+	for _, opts := range []*gsc.WriterOptions{nil, {Obfuscate: obfuscateUnits}} {
+		container := newTestContainer(t, testFiles, opts)
+		if err := fstest.TestFS(container,
+			"readme.txt", "gp/units/pik.gp", "gp/units/musk.gp", "gp/empty.gp", "pal/agew_1.pal"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestContainerOpenRaw(t *testing.T) {
+	container := newTestContainer(t, testFiles, &gsc.WriterOptions{Obfuscate: obfuscateUnits})
+
+	f, err := container.OpenRaw("gp/units/musk.gp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := testFiles["gp/units/musk.gp"].Data
+	if bytes.Equal(raw, want) {
+		t.Fatal("raw bytes are not obfuscated")
+	}
+
+	g, err := container.Open("gp/units/musk.gp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := g.(io.ReaderAt).ReadAt(buf, 5); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, want[5:9]) {
+		t.Fatalf("ReadAt = %q, want %q", buf, want[5:9])
+	}
+}
+
+func TestContainerReadDirHandles(t *testing.T) {
+	container := newTestContainer(t, testFiles, nil)
+
+	for i := 0; i < 2; i++ {
+		f, err := container.Open("gp/units")
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries, err := f.(fs.ReadDirFile).ReadDir(-1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 2 {
+			t.Fatalf("open %d: got %d entries, want 2", i, len(entries))
+		}
+		f.Close()
+	}
+}
+
+func TestContainerInvalidPaths(t *testing.T) {
+	container := newTestContainer(t, testFiles, nil)
+
+	for _, name := range []string{"/", "/readme.txt", "gp/", "./readme.txt", "gp/../readme.txt"} {
+		if _, err := container.Open(name); err == nil {
+			t.Errorf("Open(%q) succeeded", name)
+		}
+	}
+	if _, err := container.Open("GP/Units/PIK.gp"); err != nil {
+		t.Errorf("case-insensitive Open: %v", err)
+	}
+	f, err := container.Open("gp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Read(make([]byte, 1)); err == nil {
+		t.Error("Read on directory succeeded")
+	}
+}
+
+func TestContainerSubGlob(t *testing.T) {
+	container := newTestContainer(t, fstest.MapFS{
+		"gp[1]/a.gp": {Data: []byte("a")},
+		"gp[1]/b.gp": {Data: []byte("b")},
+		"gp1/c.gp":   {Data: []byte("c")},
+	}, nil)
+	sub, err := container.Sub("gp[1]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches, err := fs.Glob(sub, "*.gp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 2 || matches[0] != "a.gp" || matches[1] != "b.gp" {
+		t.Fatalf("Glob(*.gp) = %v, want [a.gp b.gp]", matches)
+	}
+}
+
+func TestContainerDeprecated(t *testing.T) {
+	container := newTestContainer(t, testFiles, nil)
+	if !container.IsDir() || container.Name() != "." {
+		t.Fatalf("root = %q, dir %v", container.Name(), container.IsDir())
+	}
+	info, err := container.Stat("gp/units")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := info.(gsc.Entry)
+	if entries, err := dir.ReadDir(1); err != nil || len(entries) != 1 || entries[0].Name() != "musk.gp" {
+		t.Fatalf("ReadDir(1) = %v, %v", entries, err)
+	}
+	if entries, err := dir.ReadDir(-1); err != nil || len(entries) != 2 {
+		t.Fatalf("ReadDir(-1) = %v, %v", entries, err)
+	}
+	if _, err := dir.Read(make([]byte, 1)); err == nil {
+		t.Fatal("Read on an entry succeeded")
+	}
+}
+
+// TestContainerConcurrent reads the same container from many goroutines; run
+// it with -race.
+func TestContainerConcurrent(t *testing.T) {
+	container := newTestContainer(t, testFiles, &gsc.WriterOptions{Obfuscate: obfuscateUnits})
+	names := []string{"readme.txt", "gp/units/pik.gp", "gp/units/musk.gp", "gp/empty.gp", "pal/agew_1.pal"}
+
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 50 {
+				name := names[(g+i)%len(names)]
+				want := testFiles[name].Data
+
+				data, err := container.ReadFile(name)
+				if err != nil || !bytes.Equal(data, want) {
+					t.Errorf("ReadFile(%q) = %q, %v", name, data, err)
+					return
+				}
+				f, err := container.Open(name)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if len(want) > 2 {
+					buf := make([]byte, 2)
+					off := int64(i % (len(want) - 1))
+					if _, err := f.(io.ReaderAt).ReadAt(buf, off); err != nil || !bytes.Equal(buf, want[off:off+2]) {
+						t.Errorf("ReadAt(%q, %d) = %q, %v", name, off, buf, err)
+					}
+				}
+				f.Close()
+				if _, err := container.ReadDir("gp/units"); err != nil {
+					t.Error(err)
+				}
+				if _, err := container.Glob("gp/*/*.gp"); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// unsized hides the size of an archive from NewContainer.
+type unsized struct {
+	io.Reader
+	io.ReaderAt
+}
+
+func newUnsized(data []byte) gsc.Reader {
+	r := bytes.NewReader(data)
+	return unsized{r, r}
+}
+
+func TestContainerUnknownSize(t *testing.T) {
+	var buf bytes.Buffer
+	if err := gsc.Build(testFiles, &buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	container, err := gsc.NewContainer(newUnsized(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(container, "readme.txt", "gp/units/pik.gp", "pal/agew_1.pal"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Claim an entry count no archive holds.
+	huge := bytes.Clone(data)
+	binary.LittleEndian.PutUint32(huge[10:], 1<<30)
+	_, err = gsc.NewContainer(newUnsized(huge))
+	var de *gsc.DecodeError
+	if !errors.As(err, &de) || de.Offset != 14 {
+		t.Fatalf("huge file table: err = %v", err)
+	}
+
+	// Claim files far larger than the archive.
+	for i := 0; 14+81*(i+1) <= len(data) && i < int(binary.LittleEndian.Uint32(data[10:])); i++ {
+		binary.LittleEndian.PutUint32(huge[14+81*i+72:], 0xFFFFFF00)
+	}
+	binary.LittleEndian.PutUint32(huge[10:], binary.LittleEndian.Uint32(data[10:]))
+	container, err = gsc.NewContainer(newUnsized(huge))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := container.ReadFile("readme.txt"); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("oversized file: err = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func FuzzNewContainer(f *testing.F) {
+	var buf bytes.Buffer
+	if err := gsc.Build(testFiles, &buf, &gsc.WriterOptions{Obfuscate: obfuscateUnits}); err != nil {
+		f.Fatal(err)
+	}
+	f.Add(buf.Bytes())
+	f.Add(buf.Bytes()[:20])
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, r := range []gsc.Reader{bytes.NewReader(data), newUnsized(data)} {
+			container, err := gsc.NewContainer(r)
+			if err != nil {
+				continue
+			}
+			fs.WalkDir(container, ".", func(name string, d fs.DirEntry, err error) error {
+				if err == nil && !d.IsDir() {
+					container.ReadFile(name)
+				}
+				return nil
+			})
+		}
+	})
+}
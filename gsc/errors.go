@@ -0,0 +1,24 @@
+package gsc
+
+import (
+	"errors"
+
+	"gitgub.com/cam-per/gossacks/gsc/internal/decode"
+)
+
+var (
+	errNotDir  = errors.New("not a directory")
+	errIsDir   = errors.New("is a directory")
+	errNotOpen = errors.New("entry is not open")
+)
+
+// DecodeError describes a problem found while decoding an archive or an
+// asset, locating it as precisely as the decoder could. Sprite, Frame and
+// Offset are -1 when they do not apply or are unknown. Every package of gsc
+// reports its decoding problems with it.
+type DecodeError = decode.Error
+
+// NewDecodeError returns a DecodeError for format with no location.
+func NewDecodeError(format, reason string, err error) *DecodeError {
+	return decode.NewError(format, reason, err)
+}
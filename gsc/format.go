@@ -0,0 +1,96 @@
+package gsc
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrUnknownFormat = errors.New("gsc: unknown format")
+)
+
+// Format describes a kind of asset stored in archives.
+type Format struct {
+	Name string
+	// Extensions lists the lowercase file extensions, with the leading dot,
+	// the format is stored under.
+	Extensions []string
+	// Sniff reports whether the contents of r look like the format. size is
+	// the length of r, or -1 when it is unknown. A nil Sniff matches by
+	// extension only.
+	Sniff func(r io.ReaderAt, size int64) bool
+}
+
+var (
+	formatsMu sync.RWMutex
+	formats   []Format
+)
+
+// RegisterFormat adds f to the formats known to Detect. Packages decoding a
+// format usually register it from an init function.
+func RegisterFormat(f Format) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	formats = append(formats, f)
+}
+
+// Formats returns the registered formats in registration order.
+func Formats() []Format {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	return slices.Clone(formats)
+}
+
+// Detect returns the format of the asset read from r. The contents are tried
+// against every registered sniffer first; when none matches, the extension of
+// name decides. ErrUnknownFormat is returned when neither does.
+func Detect(r io.ReaderAt, name string) (Format, error) {
+	size := readerSize(r)
+	list := Formats()
+	for _, f := range list {
+		if f.Sniff != nil && f.Sniff(r, size) {
+			return f, nil
+		}
+	}
+
+	ext := strings.ToLower(path.Ext(name))
+	for _, f := range list {
+		if ext != "" && slices.Contains(f.Extensions, ext) {
+			return f, nil
+		}
+	}
+	return Format{}, ErrUnknownFormat
+}
+
+// Magic returns a sniffer matching contents that start with magic.
+func Magic(magic string) func(io.ReaderAt, int64) bool {
+	return func(r io.ReaderAt, size int64) bool {
+		if size >= 0 && size < int64(len(magic)) {
+			return false
+		}
+		buf := make([]byte, len(magic))
+		if n, err := r.ReadAt(buf, 0); n < len(buf) || (err != nil && !errors.Is(err, io.EOF)) {
+			return false
+		}
+		return string(buf) == magic
+	}
+}
+
+// readerSize returns the length of r when it tells it through a Size or Stat
+// method, and -1 otherwise.
+func readerSize(r io.ReaderAt) int64 {
+	switch r := r.(type) {
+	case interface{ Size() int64 }:
+		return r.Size()
+	case interface{ Stat() (fs.FileInfo, error) }:
+		if info, err := r.Stat(); err == nil {
+			return info.Size()
+		}
+	}
+	return -1
+}
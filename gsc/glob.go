@@ -0,0 +1,100 @@
+package gsc
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// globFold is fs.Glob with case-insensitive matching of every path element,
+// driven by the given readDir function. Matches are spelled as stored, not as
+// in the pattern.
+func globFold(pattern string, readDir func(string) ([]fs.DirEntry, error)) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	if !hasMeta(pattern) {
+		if name, ok := resolveFold(pattern, readDir); ok {
+			return []string{name}, nil
+		}
+		return nil, nil
+	}
+
+	dir, file := path.Split(pattern)
+	dir = cleanGlobPath(dir)
+	if !hasMeta(dir) {
+		resolved, ok := resolveFold(dir, readDir)
+		if !ok {
+			return nil, nil
+		}
+		return globDirFold(resolved, file, readDir), nil
+	}
+	if dir == pattern {
+		return nil, path.ErrBadPattern
+	}
+
+	dirs, err := globFold(dir, readDir)
+	if err != nil {
+		return nil, err
+	}
+	var matches []string
+	for _, d := range dirs {
+		matches = append(matches, globDirFold(d, file, readDir)...)
+	}
+	return matches, nil
+}
+
+func globDirFold(dir, pattern string, readDir func(string) ([]fs.DirEntry, error)) []string {
+	entries, err := readDir(dir)
+	if err != nil {
+		return nil
+	}
+	pattern = strings.ToLower(pattern)
+	var matches []string
+	for _, e := range entries {
+		if ok, _ := path.Match(pattern, strings.ToLower(e.Name())); ok {
+			matches = append(matches, path.Join(dir, e.Name()))
+		}
+	}
+	return matches
+}
+
+// resolveFold returns name spelled as stored, matching each element
+// case-insensitively.
+func resolveFold(name string, readDir func(string) ([]fs.DirEntry, error)) (string, bool) {
+	resolved := "."
+	if name == resolved {
+		return resolved, true
+	}
+	for _, elem := range strings.Split(name, "/") {
+		entries, err := readDir(resolved)
+		if err != nil {
+			return "", false
+		}
+		found := ""
+		for _, e := range entries {
+			if strings.EqualFold(e.Name(), elem) {
+				found = e.Name()
+				break
+			}
+		}
+		if found == "" {
+			return "", false
+		}
+		resolved = path.Join(resolved, found)
+	}
+	return resolved, true
+}
+
+func cleanGlobPath(dir string) string {
+	switch dir {
+	case "":
+		return "."
+	default:
+		return dir[:len(dir)-1]
+	}
+}
+
+func hasMeta(p string) bool {
+	return strings.ContainsAny(p, `*?[\`)
+}
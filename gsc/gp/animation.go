@@ -0,0 +1,139 @@
+package gp
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"time"
+)
+
+var (
+	ErrDirection = errors.New("gp: direction out of range")
+)
+
+type ComposeOptions struct {
+	// Mirror flips the frame horizontally around the sprite origin.
+	Mirror bool
+	// Op is the compositing operator. The zero value is draw.Over.
+	Op draw.Op
+}
+
+// Compose draws frame i of the sprite into dst with the sprite origin at
+// at. opts may be nil.
+func (sprite *Sprite) Compose(i int, dst draw.Image, at image.Point, opts *ComposeOptions) error {
+	if i < 0 || i >= len(sprite.Frames) {
+		return ErrOutOfRange
+	}
+	frame := sprite.Frames[i]
+	if frame == nil || frame.Image == nil {
+		return nil
+	}
+	if opts == nil {
+		opts = &ComposeOptions{}
+	}
+
+	var src image.Image = frame.Image
+	rect := frame.Rect()
+	if opts.Mirror {
+		src = mirrored{frame.Image}
+		rect = image.Rect(-rect.Max.X, rect.Min.Y, -rect.Min.X, rect.Max.Y)
+	}
+	draw.Draw(dst, rect.Add(at), src, frame.Image.Bounds().Min, opts.Op)
+	return nil
+}
+
+// mirrored is an image flipped horizontally within its bounds.
+type mirrored struct {
+	image.Image
+}
+
+func (m mirrored) At(x, y int) color.Color {
+	b := m.Bounds()
+	return m.Image.At(b.Max.X-1-(x-b.Min.X), y)
+}
+
+// Animation plays a run of sprite frames seen from several directions.
+//
+// The frames of an animation follow each other direction by direction,
+// Length frames each, starting at frame Start of the sprite. Only the first
+// Stored directions have frames; the remaining ones, going round the circle,
+// reuse the stored direction on the mirrored side, drawn flipped.
+type Animation struct {
+	Sprite     *Sprite
+	Start      int
+	Length     int
+	Directions int
+	// Stored is the number of directions with frames. Zero means all of
+	// them.
+	Stored int
+	// Sequence lists the order frames are played in within a direction, as
+	// indices below Length. Nil plays them in order.
+	Sequence []int
+	Delay    time.Duration
+	Loop     bool
+}
+
+// Steps returns the number of steps one cycle of the animation has.
+func (anim *Animation) Steps() int {
+	if anim.Sequence != nil {
+		return len(anim.Sequence)
+	}
+	return anim.Length
+}
+
+// Duration returns the length of one cycle.
+func (anim *Animation) Duration() time.Duration {
+	return time.Duration(anim.Steps()) * anim.Delay
+}
+
+// Step returns the step shown at time t: it wraps around for looping
+// animations and stays on the last step otherwise.
+func (anim *Animation) Step(t time.Duration) int {
+	steps := anim.Steps()
+	if steps == 0 || anim.Delay <= 0 || t < 0 {
+		return 0
+	}
+	step := int(t / anim.Delay)
+	if anim.Loop {
+		return step % steps
+	}
+	return min(step, steps-1)
+}
+
+// Frame returns the sprite frame shown at step of direction, and whether it
+// is drawn mirrored.
+func (anim *Animation) Frame(direction, step int) (int, bool, error) {
+	if direction < 0 || direction >= anim.Directions {
+		return 0, false, ErrDirection
+	}
+	if step < 0 || step >= anim.Steps() {
+		return 0, false, ErrOutOfRange
+	}
+	if anim.Sequence != nil {
+		step = anim.Sequence[step]
+	}
+
+	stored := anim.Stored
+	if stored == 0 {
+		stored = anim.Directions
+	}
+	mirror := false
+	if direction >= stored {
+		direction, mirror = anim.Directions-direction, true
+		if direction >= stored {
+			return 0, false, ErrDirection
+		}
+	}
+	return anim.Start + direction*anim.Length + step, mirror, nil
+}
+
+// Compose draws the frame shown at time t facing direction into dst with
+// the sprite origin at at.
+func (anim *Animation) Compose(dst draw.Image, at image.Point, direction int, t time.Duration) error {
+	i, mirror, err := anim.Frame(direction, anim.Step(t))
+	if err != nil {
+		return err
+	}
+	return anim.Sprite.Compose(i, dst, at, &ComposeOptions{Mirror: mirror})
+}
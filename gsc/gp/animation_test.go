@@ -0,0 +1,174 @@
+package gp
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+	"time"
+)
+
+func TestFrameRect(t *testing.T) {
+	// Frames wider than high caught the max Y taken from Dx+Ly.
+	frame := NewFrame(image.NewPaletted(image.Rect(0, 0, 12, 8), testPalette()), image.Pt(2, 3))
+	if want := image.Rect(2, 3, 14, 11); frame.Rect() != want {
+		t.Fatalf("Rect = %v, want %v", frame.Rect(), want)
+	}
+	sprite := testSprite()
+	if want := image.Rect(-2, -4, 15, 9); sprite.Rect() != want {
+		t.Fatalf("sprite Rect = %v, want %v", sprite.Rect(), want)
+	}
+}
+
+// checkCompose checks that frame i of sprite is drawn into dst with the
+// sprite origin at at, flipped around it when mirror is set, and that no
+// pixel outside it is touched.
+func checkCompose(t *testing.T, sprite *Sprite, i int, dst *image.RGBA, at image.Point, mirror bool) {
+	t.Helper()
+	frame := sprite.Frames[i]
+	rect, b := frame.Rect(), frame.Image.Bounds()
+	drawn := make(map[image.Point]bool)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			p := image.Pt(x, y).Add(at)
+			if mirror {
+				p.X = at.X - x - 1
+			}
+			drawn[p] = true
+			want := color.RGBAModel.Convert(frame.Image.At(b.Min.X+x-rect.Min.X, b.Min.Y+y-rect.Min.Y))
+			if got := dst.At(p.X, p.Y); got != want {
+				t.Fatalf("frame %d: pixel %v = %v, want %v", i, p, got, want)
+			}
+		}
+	}
+	for y := dst.Rect.Min.Y; y < dst.Rect.Max.Y; y++ {
+		for x := dst.Rect.Min.X; x < dst.Rect.Max.X; x++ {
+			if !drawn[image.Pt(x, y)] && dst.RGBAAt(x, y) != (color.RGBA{}) {
+				t.Fatalf("frame %d: pixel (%d, %d) outside the frame was drawn", i, x, y)
+			}
+		}
+	}
+}
+
+func TestCompose(t *testing.T) {
+	sprite := testSprite()
+	at := image.Pt(20, 20)
+	for i := range sprite.Frames {
+		for _, mirror := range []bool{false, true} {
+			dst := image.NewRGBA(image.Rect(0, 0, 40, 40))
+			if err := sprite.Compose(i, dst, at, &ComposeOptions{Mirror: mirror, Op: draw.Src}); err != nil {
+				t.Fatal(err)
+			}
+			checkCompose(t, sprite, i, dst, at, mirror)
+		}
+	}
+
+	// Over leaves the canvas showing through transparent pixels.
+	dst := image.NewRGBA(image.Rect(0, 0, 40, 40))
+	draw.Draw(dst, dst.Rect, image.NewUniform(color.RGBA{R: 9, A: 0xFF}), image.Point{}, draw.Src)
+	if err := sprite.Compose(0, dst, at, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := dst.RGBAAt(at.X, at.Y); got != (color.RGBA{R: 9, A: 0xFF}) {
+		t.Errorf("transparent pixel drawn over: %v", got)
+	}
+
+	for _, i := range []int{-1, len(sprite.Frames)} {
+		if err := sprite.Compose(i, dst, at, nil); err != ErrOutOfRange {
+			t.Errorf("Compose(%d): err = %v, want %v", i, err, ErrOutOfRange)
+		}
+	}
+}
+
+func TestAnimationFrame(t *testing.T) {
+	anim := &Animation{Start: 2, Length: 3, Directions: 8, Stored: 5}
+	for _, tc := range []struct {
+		direction, step int
+		frame           int
+		mirror          bool
+	}{
+		{0, 0, 2, false},
+		{0, 2, 4, false},
+		{1, 0, 5, false},
+		{4, 1, 15, false},
+		{5, 1, 3*3 + 2 + 1, true},
+		{6, 0, 2*3 + 2, true},
+		{7, 2, 1*3 + 2 + 2, true},
+	} {
+		frame, mirror, err := anim.Frame(tc.direction, tc.step)
+		if err != nil || frame != tc.frame || mirror != tc.mirror {
+			t.Errorf("Frame(%d, %d) = %d, %v, %v, want %d, %v", tc.direction, tc.step, frame, mirror, err, tc.frame, tc.mirror)
+		}
+	}
+	for _, ds := range [][2]int{{-1, 0}, {8, 0}} {
+		if _, _, err := anim.Frame(ds[0], ds[1]); err != ErrDirection {
+			t.Errorf("Frame(%d, %d): err = %v, want %v", ds[0], ds[1], err, ErrDirection)
+		}
+	}
+	if _, _, err := anim.Frame(0, 3); err != ErrOutOfRange {
+		t.Errorf("Frame(0, 3): err = %v, want %v", err, ErrOutOfRange)
+	}
+
+	// Too few stored directions to mirror the missing ones.
+	anim.Stored = 4
+	if _, _, err := anim.Frame(4, 0); err != ErrDirection {
+		t.Errorf("unmirrorable direction: err = %v, want %v", err, ErrDirection)
+	}
+
+	// All directions stored, played in sequence.
+	anim = &Animation{Length: 3, Directions: 2, Sequence: []int{2, 0, 0, 1}}
+	if anim.Steps() != 4 {
+		t.Fatalf("Steps = %d, want 4", anim.Steps())
+	}
+	if frame, mirror, err := anim.Frame(1, 0); err != nil || frame != 5 || mirror {
+		t.Errorf("sequence: Frame(1, 0) = %d, %v, %v", frame, mirror, err)
+	}
+}
+
+func TestAnimationStep(t *testing.T) {
+	anim := &Animation{Length: 4, Directions: 1, Delay: 100 * time.Millisecond}
+	if anim.Duration() != 400*time.Millisecond {
+		t.Fatalf("Duration = %v", anim.Duration())
+	}
+	for _, loop := range []bool{false, true} {
+		anim.Loop = loop
+		for _, tc := range []struct {
+			t          time.Duration
+			once, loop int
+		}{{-1, 0, 0}, {0, 0, 0}, {99 * time.Millisecond, 0, 0}, {250 * time.Millisecond, 2, 2}, {500 * time.Millisecond, 3, 1}} {
+			want := tc.once
+			if loop {
+				want = tc.loop
+			}
+			if got := anim.Step(tc.t); got != want {
+				t.Errorf("loop %v: Step(%v) = %d, want %d", loop, tc.t, got, want)
+			}
+		}
+	}
+}
+
+func TestAnimationCompose(t *testing.T) {
+	sprite := testSprite()
+	// Three stored directions of three frames seen from four directions,
+	// the last one mirroring the second.
+	sprite.Frames = append(sprite.Frames, append(sprite.Frames, sprite.Frames...)...)
+	anim := &Animation{Sprite: sprite, Length: 3, Directions: 4, Stored: 3, Delay: time.Second}
+	at := image.Pt(20, 20)
+
+	dst := image.NewRGBA(image.Rect(0, 0, 40, 40))
+	if err := anim.Compose(dst, at, 3, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	want := image.NewRGBA(dst.Rect)
+	if err := sprite.Compose(5, want, at, &ComposeOptions{Mirror: true}); err != nil {
+		t.Fatal(err)
+	}
+	for i := range dst.Pix {
+		if dst.Pix[i] != want.Pix[i] {
+			t.Fatal("mirrored direction differs from the mirrored stored frame")
+		}
+	}
+	if err := anim.Compose(dst, at, 4, 0); err != ErrDirection {
+		t.Fatalf("err = %v, want %v", err, ErrDirection)
+	}
+}
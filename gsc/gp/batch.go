@@ -0,0 +1,146 @@
+package gp
+
+import (
+	"context"
+	"image/color"
+	"io/fs"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// BatchOptions configures DecodeFS.
+type BatchOptions struct {
+	// Match selects the files to decode by path. Nil matches files with a
+	// .gp extension in any case.
+	Match func(name string) bool
+	// Workers is the number of files decoded at once. Zero means
+	// runtime.GOMAXPROCS(0).
+	Workers int
+	// Options are passed to NewDecoder for every file, after a WithPath
+	// naming it.
+	Options []Option
+	// Progress, when not nil, is called with the number of files done and
+	// the number of matching files: once with none done when decoding
+	// starts, then after every result.
+	Progress func(done, total int)
+}
+
+// BatchResult is the outcome of decoding one file of a batch.
+type BatchResult struct {
+	Name    string
+	Decoder *Decoder
+	Err     error
+}
+
+// DecodeFS decodes the matching files of fsys in parallel and calls fn with
+// each result in the order they finish. fn and the Progress callback are
+// only called from the goroutine calling DecodeFS. batch may be nil.
+//
+// DecodeFS stops when ctx is done or fn returns an error, and returns that
+// error once every worker has stopped. Failing to decode a file is not an
+// error of the batch; it is reported in the file's result.
+func DecodeFS(ctx context.Context, fsys fs.FS, palette color.Palette, batch *BatchOptions, fn func(BatchResult) error) error {
+	if batch == nil {
+		batch = &BatchOptions{}
+	}
+	match := batch.Match
+	if match == nil {
+		match = func(name string) bool { return strings.EqualFold(path.Ext(name), ".gp") }
+	}
+
+	var names []string
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.IsDir() && match(name) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if batch.Progress != nil {
+		batch.Progress(0, len(names))
+	}
+
+	workers := batch.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	workers = min(workers, len(names))
+
+	work, cancel := context.WithCancel(ctx)
+	defer cancel()
+	jobs := make(chan string)
+	results := make(chan BatchResult)
+
+	go func() {
+		defer close(jobs)
+		for _, name := range names {
+			select {
+			case jobs <- name:
+			case <-work.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range jobs {
+				result := BatchResult{Name: name}
+				result.Decoder, result.Err = decodeFile(work, fsys, name, palette, batch.Options)
+				select {
+				case results <- result:
+				case <-work.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Cancelling lets the workers go; draining waits for them to.
+	defer func() {
+		cancel()
+		for range results {
+		}
+	}()
+
+	done := 0
+	for result := range results {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(result); err != nil {
+			return err
+		}
+		done++
+		if batch.Progress != nil {
+			batch.Progress(done, len(names))
+		}
+	}
+	return ctx.Err()
+}
+
+func decodeFile(ctx context.Context, fsys fs.FS, name string, palette color.Palette, opts []Option) (*Decoder, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return newDecoder(ctx, f, palette, append([]Option{WithPath(name)}, opts...))
+}
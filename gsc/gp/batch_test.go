@@ -0,0 +1,109 @@
+package gp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"gitgub.com/cam-per/gossacks/gsc"
+)
+
+// batchFiles returns n GP files with one sprite of i+1 frames each, a
+// broken GP file and a file that is not a GP.
+func batchFiles(t *testing.T, n int) fstest.MapFS {
+	t.Helper()
+	palette := testPalette()
+	files := fstest.MapFS{
+		"units/broken.gp": {Data: []byte("GPAK")},
+		"readme.txt":      {Data: []byte("not a sprite")},
+	}
+	for i := range n {
+		sprite := Sprite{}
+		for range i + 1 {
+			sprite.Frames = append(sprite.Frames, NewFrame(testImage(palette), image.Pt(i, 0)))
+		}
+		files[fmt.Sprintf("units/u%02d.gp", i)] = &fstest.MapFile{Data: encode(t, sprite)}
+	}
+	return files
+}
+
+func TestDecodeFS(t *testing.T) {
+	files := batchFiles(t, 20)
+
+	// Decode from a container too, which the workers read concurrently.
+	var archive bytes.Buffer
+	if err := gsc.Build(files, &archive, nil); err != nil {
+		t.Fatal(err)
+	}
+	container, err := gsc.NewContainer(bytes.NewReader(archive.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fsys := range []fs.FS{files, container} {
+		var progress []int
+		got := map[string]int{}
+		err := DecodeFS(context.Background(), fsys, testPalette(), &BatchOptions{
+			Workers:  4,
+			Progress: func(done, total int) { progress = append(progress, done, total) },
+		}, func(result BatchResult) error {
+			if result.Err != nil {
+				got[result.Name] = -1
+				return nil
+			}
+			got[result.Name] = len(result.Decoder.Sprites[0].Frames)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(got) != 21 || got["units/broken.gp"] != -1 {
+			t.Fatalf("results = %v", got)
+		}
+		for i := range 20 {
+			if name := fmt.Sprintf("units/u%02d.gp", i); got[name] != i+1 {
+				t.Errorf("%s: %d frames, want %d", name, got[name], i+1)
+			}
+		}
+		if len(progress) != 2*22 || progress[0] != 0 || progress[len(progress)-2] != 21 || progress[len(progress)-1] != 21 {
+			t.Errorf("progress = %v", progress)
+		}
+	}
+}
+
+func TestDecodeFSCancel(t *testing.T) {
+	files := batchFiles(t, 50)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	calls := 0
+	err := DecodeFS(ctx, files, testPalette(), &BatchOptions{Workers: 4}, func(BatchResult) error {
+		calls++
+		if calls == 3 {
+			cancel()
+		}
+		return nil
+	})
+	if err != context.Canceled {
+		t.Fatalf("err = %v, want %v", err, context.Canceled)
+	}
+	if calls != 3 {
+		t.Fatalf("fn called %d times after cancelling, want 0", calls-3)
+	}
+
+	stop := errors.New("stop")
+	calls = 0
+	err = DecodeFS(context.Background(), files, testPalette(), nil, func(BatchResult) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Fatalf("err = %v after %d calls, want %v after 1", err, calls, stop)
+	}
+}
@@ -3,140 +3,66 @@ package gp
 import (
 	"bufio"
 	"bytes"
-	"encoding/binary"
+	"context"
 	"errors"
 	"image/color"
 	"io"
 
-	"gitgub.com/cam-per/gossacks/gsc/lzstd"
+	"gitgub.com/cam-per/gossacks/gsc"
+	"gitgub.com/cam-per/gossacks/gsc/internal/decode"
 )
 
+// Decoder reads a whole GP file and decodes every frame of every sprite. Use
+// Open to decode frames on demand instead.
 type Decoder struct {
-	header  header
-	r       *bytes.Reader
-	fmap    []byte
-	voc     []byte
-	palette color.Palette
+	reader  *Reader
 	Sprites []Sprite
 }
 
-func NewDecoder(r io.Reader, palette color.Palette) (*Decoder, error) {
+func NewDecoder(r io.Reader, palette color.Palette, opts ...Option) (*Decoder, error) {
+	return newDecoder(context.Background(), r, palette, opts)
+}
+
+// newDecoder is NewDecoder giving up between frames once ctx is done.
+func newDecoder(ctx context.Context, r io.Reader, palette color.Palette, opts []Option) (*Decoder, error) {
 	data, err := io.ReadAll(bufio.NewReader(r))
 	if err != nil {
 		return nil, err
 	}
-	decoder := &Decoder{
-		r:       bytes.NewReader(data),
-		fmap:    data,
-		palette: palette,
+	reader, err := newReader(bytes.NewReader(data), data, int64(len(data)), palette, opts)
+	if err != nil {
+		return nil, err
 	}
-	if err := decoder.decode(); err != nil {
+	decoder := &Decoder{reader: reader}
+	if err := decoder.decode(ctx); err != nil {
 		return nil, err
 	}
 	return decoder, nil
 }
 
-func (decoder *Decoder) decode() error {
-	if err := binary.Read(decoder.r, binary.LittleEndian, &decoder.header); err != nil {
-		return err
-	}
-
-	frames := make([]uint32, decoder.header.PicturesCount)
-	if err := binary.Read(decoder.r, binary.LittleEndian, &frames); err != nil {
-		return err
-	}
-
-	decoder.voc = make([]byte, decoder.header.VocLength)
-	if _, err := decoder.r.ReadAt(decoder.voc, int64(decoder.header.VocOffset)); err != nil {
-		return err
-	}
-
-	decoder.Sprites = make([]Sprite, decoder.header.PicturesCount)
+func (decoder *Decoder) decode(ctx context.Context) error {
+	decoder.Sprites = make([]Sprite, decoder.reader.Len())
 	for i := range decoder.Sprites {
-		if err := decoder.decodeSprite(int64(frames[i]), &decoder.Sprites[i]); err != nil {
-			return err
+		for j := 0; j < decoder.reader.Frames(i); j++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			frame, err := decoder.reader.Frame(i, j)
+			if err != nil {
+				var de *decode.Error
+				if !errors.As(err, &de) {
+					return err
+				}
+				if err := decoder.reader.problem(de); err != nil {
+					return err
+				}
+			}
+			decoder.Sprites[i].addFrame(frame)
 		}
 	}
 	return nil
 }
 
-func (decoder *Decoder) decodeFrame(offset int64) (*Frame, int64, error) {
-	var h frameHeader
-	if err := binary.Read(decoder.offsetReader(offset), binary.LittleEndian, &h); err != nil {
-		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
-			return nil, -1, nil
-		}
-		return nil, -1, err
-	}
-
-	if h.Lines != h.Ly {
-		return nil, -1, nil
-	}
-
-	frame := &Frame{
-		offset:    offset,
-		header:    h,
-		lineFlags: decoder.fmap[offset+int64(frameHeaderSize):],
-	}
-
-	var err error
-	switch frame.Type() {
-	case StandardFrame:
-		err = decoder.decodeStandardFrame(frame)
-	}
-
-	return frame, int64(h.Next), err
-}
-
-func (decoder *Decoder) decodeStandardFrame(frame *Frame) error {
-	coff := int64(frame.header.CData & 0x3FFF)
-	if (frame.header.Options & 64) != 0 {
-		coff += 16384
-	}
-	if (frame.header.Options & 128) != 0 {
-		coff += 32768
-	}
-
-	clen := int64(frame.header.CData) >> 14
-	if (frame.header.Options & 63) == 43 {
-		clen += 262144
-	}
-	if (frame.header.Options & 63) == 42 {
-		clen += 262144 * 2
-	}
-	shaper := decoder.offsetReader(frame.offset + int64(frameHeaderSize))
-	painter := lzstd.NewDecoder(decoder.offsetReader(frame.offset+coff), decoder.voc, clen)
-
-	err := frame.renderStd(shaper, painter, decoder.palette)
-	if err == io.EOF {
-		return nil
-	}
-	return err
-}
-
-func (decoder *Decoder) offsetReader(offset int64) *bytes.Reader {
-	end := int64(len(decoder.fmap))
-	if offset < 0 || offset >= end {
-		return bytes.NewReader(nil)
-	}
-	//length := end - offset
-	return bytes.NewReader(decoder.fmap[offset:])
-}
-
-func (decoder *Decoder) decodeSprite(offset int64, sprite *Sprite) error {
-	for {
-		frame, next, err := decoder.decodeFrame(offset)
-		if err != nil {
-			return err
-		}
-		if frame == nil {
-			break
-		}
-		sprite.addFrame(frame)
-		if next == -1 {
-			break
-		}
-		offset += next
-	}
-	return nil
-}
+// Problems returns the problems found in the file when decoding in the
+// default, lenient mode.
+func (decoder *Decoder) Problems() []*gsc.DecodeError { return decoder.reader.Problems() }
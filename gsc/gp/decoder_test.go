@@ -0,0 +1,244 @@
+package gp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gitgub.com/cam-per/gossacks/gsc"
+)
+
+var update = flag.Bool("update", false, "rewrite golden images in testdata")
+
+func testPalette() color.Palette {
+	palette := make(color.Palette, 256)
+	for i := range palette {
+		palette[i] = color.RGBA{R: uint8(i), G: uint8(255 - i), B: uint8(i * 7), A: 0xFF}
+	}
+	return palette
+}
+
+// testImage draws a 12x8 pattern with transparent gaps, long runs and
+// single pixels, exercising both line encodings.
+func testImage(palette color.Palette) *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, 12, 8), append(color.Palette{color.Transparent}, palette[1:]...))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 12; x++ {
+			if (x+y)%5 == 0 || (y == 3 && x > 6) {
+				continue
+			}
+			img.SetColorIndex(x, y, uint8(1+x*20+y))
+		}
+	}
+	return img
+}
+
+// encode encodes sprites as a GP file in the test palette.
+func encode(tb testing.TB, sprites ...Sprite) []byte {
+	tb.Helper()
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf, testPalette()).Encode(sprites); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// decodeFrame encodes a single frame of type frameType drawing img at offset
+// and decodes it back with opts.
+func decodeFrame(t *testing.T, frameType FrameType, img *image.Paletted, offset image.Point, opts ...Option) *Frame {
+	t.Helper()
+	data := encode(t, Sprite{Frames: []*Frame{NewTypedFrame(frameType, img, offset)}})
+	decoder, err := NewDecoder(bytes.NewReader(data), testPalette(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoder.Sprites) != 1 || len(decoder.Sprites[0].Frames) != 1 {
+		t.Fatalf("decoded %d sprites, want 1 with 1 frame", len(decoder.Sprites))
+	}
+	frame := decoder.Sprites[0].Frames[0]
+	if frame.Type() != frameType {
+		t.Fatalf("frame type = %d, want %d", frame.Type(), frameType)
+	}
+	if want := (image.Rectangle{Min: offset, Max: offset.Add(img.Rect.Size())}); frame.Rect() != want {
+		t.Fatalf("rect = %v, want %v", frame.Rect(), want)
+	}
+	return frame
+}
+
+func checkGolden(t *testing.T, name string, img image.Image) {
+	t.Helper()
+	golden := filepath.Join("testdata", name+".png")
+	if *update {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.Open(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	want, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if img.Bounds() != want.Bounds() {
+		t.Fatalf("bounds = %v, want %v", img.Bounds(), want.Bounds())
+	}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			got := color.NRGBAModel.Convert(img.At(x, y))
+			exp := color.NRGBAModel.Convert(want.At(x, y))
+			if got != exp {
+				t.Fatalf("pixel (%d, %d) = %v, want %v", x, y, got, exp)
+			}
+		}
+	}
+}
+
+func TestDecodeFrameTypes(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		frameType FrameType
+		alpha     uint8
+	}{
+		{"standard", StandardFrame, 0xFF},
+		{"transparent50", Transparent50Frame, 0x80},
+		{"transparent75", Transparent75Frame, 0xC0},
+		{"shadow", ShadowFrame, 0x80},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			frame := decodeFrame(t, tc.frameType, testImage(testPalette()), image.Pt(2, 3))
+			checkGolden(t, tc.name, frame.Image)
+
+			if _, _, _, a := frame.Image.At(1, 0).RGBA(); a>>8 != uint32(tc.alpha) {
+				t.Errorf("alpha = %#x, want %#x", a>>8, tc.alpha)
+			}
+			if _, _, _, a := frame.Image.At(0, 0).RGBA(); a != 0 {
+				t.Errorf("transparent pixel has alpha %#x", a)
+			}
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	palette := testPalette()
+	data := encode(t, Sprite{Frames: []*Frame{NewFrame(testImage(palette), image.Pt(2, 3))}})
+
+	// Claim far more colour data than the frame holds.
+	frame := int(binary.LittleEndian.Uint32(data[binary.Size(header{}):]))
+	cdata := frame + 17
+	binary.LittleEndian.PutUint32(data[cdata:], binary.LittleEndian.Uint32(data[cdata:])|0xFFFF<<14)
+
+	_, err := NewDecoder(bytes.NewReader(data), palette, WithStrict(), WithPath("broken.gp"))
+	var de *gsc.DecodeError
+	if !errors.As(err, &de) {
+		t.Fatalf("strict: err = %v, want a *gsc.DecodeError", err)
+	}
+	if de.Path != "broken.gp" || de.Sprite != 0 || de.Frame != 0 || de.Offset <= int64(frame) {
+		t.Fatalf("strict: err = %v", de)
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(data), palette)
+	if err != nil {
+		t.Fatalf("lenient: %v", err)
+	}
+	if problems := decoder.Problems(); len(problems) != 1 || problems[0].Offset != de.Offset {
+		t.Fatalf("lenient: problems = %v, want [%v]", problems, de)
+	}
+	if len(decoder.Sprites[0].Frames) != 1 || decoder.Sprites[0].Frames[0].Image == nil {
+		t.Fatal("lenient: broken frame should be kept with its image")
+	}
+}
+
+func TestDecodeTruncatedColours(t *testing.T) {
+	palette := testPalette()
+	img := testImage(palette)
+	data := encode(t, Sprite{Frames: []*Frame{NewFrame(img, image.Point{})}})
+	// The colours of the last frame end the file.
+	data = data[:len(data)-2]
+
+	if _, err := NewDecoder(bytes.NewReader(data), palette, WithStrict()); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("strict: err = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(data), palette, WithPaletted(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problems := decoder.Problems(); len(problems) != 1 || problems[0].Frame != 0 || !errors.Is(problems[0], io.ErrUnexpectedEOF) {
+		t.Fatalf("problems = %v", problems)
+	}
+
+	// Pixels are drawn in order up to the last colour decoded.
+	got := decoder.Sprites[0].Frames[0].Image.(*image.Paletted)
+	drawn, missing := 0, 0
+	for i, idx := range img.Pix {
+		switch {
+		case idx == 0:
+			if got.Pix[i] != 0 {
+				t.Fatalf("pixel %d drawn outside the shape", i)
+			}
+		case got.Pix[i] == idx && missing == 0:
+			drawn++
+		case got.Pix[i] == 0:
+			missing++
+		default:
+			t.Fatalf("pixel %d = %d, want %d or undrawn", i, got.Pix[i], idx)
+		}
+	}
+	if drawn == 0 || missing == 0 {
+		t.Fatalf("%d pixels drawn and %d missing, want some of each", drawn, missing)
+	}
+}
+
+func FuzzDecoder(f *testing.F) {
+	palette := testPalette()
+	var sprites []Sprite
+	for _, t := range []FrameType{StandardFrame, Transparent50Frame, ShadowFrame, NationalMaskFrame} {
+		sprites = append(sprites, Sprite{Frames: []*Frame{
+			NewTypedFrame(t, testImage(palette), image.Pt(2, 3)),
+			NewTypedFrame(t, testImage(palette), image.Pt(-1, 0)),
+		}})
+	}
+	data := encode(f, sprites...)
+	f.Add(data)
+
+	// The second frame of the first sprite leads back to the first.
+	looping := bytes.Clone(data)
+	reader, err := Open(bytes.NewReader(looping), int64(len(looping)), palette)
+	if err != nil {
+		f.Fatal(err)
+	}
+	first, second := reader.sprites[0][0].offset, reader.sprites[0][1].offset
+	binary.LittleEndian.PutUint32(looping[second:], uint32(int32(first-second)))
+	f.Add(looping)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, opts := range [][]Option{nil, {WithPaletted(0)}, {WithStrict()}} {
+			if decoder, err := NewDecoder(bytes.NewReader(data), palette[:16], opts...); err == nil {
+				dst := image.NewRGBA(image.Rect(-32, -32, 32, 32))
+				for i := range decoder.Sprites {
+					for j := range decoder.Sprites[i].Frames {
+						decoder.Sprites[i].Compose(j, dst, image.Point{}, &ComposeOptions{Mirror: j%2 == 1})
+					}
+				}
+			}
+		}
+	})
+}
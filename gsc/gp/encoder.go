@@ -1 +1,334 @@
 package gp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+
+	"gitgub.com/cam-per/gossacks/gsc/lzstd"
+)
+
+var (
+	ErrNoPalette     = errors.New("gp: palette required for non-paletted images")
+	ErrFrameTooLarge = errors.New("gp: frame too large")
+	ErrNoImage       = errors.New("gp: frame has no image")
+)
+
+var signature = [4]byte{'G', 'P', 'A', 'K'}
+
+const (
+	maxColorLength = 1<<18 - 1
+	maxColorOffset = 1<<16 - 1
+	maxShortPacks  = 0x1F
+	maxLongPairs   = 0x7F
+)
+
+type Encoder struct {
+	w       io.Writer
+	palette color.Palette
+}
+
+func NewEncoder(w io.Writer, palette color.Palette) *Encoder {
+	return &Encoder{w: w, palette: palette}
+}
+
+// NewFrame returns a standard frame drawing img with its top-left corner at
+// offset inside the sprite.
+func NewFrame(img image.Image, offset image.Point) *Frame {
+	return NewTypedFrame(StandardFrame, img, offset)
+}
+
+// NewTypedFrame is like NewFrame for frames of type t.
+func NewTypedFrame(t FrameType, img image.Image, offset image.Point) *Frame {
+	b := img.Bounds()
+	return &Frame{
+		Image: img,
+		header: frameHeader{
+			Dx: int16(offset.X), Dy: int16(offset.Y),
+			Lx: int16(b.Dx()), Ly: int16(b.Dy()),
+			Options: uint8(t),
+		},
+	}
+}
+
+// Encode writes sprites as a GP file. Frames are stored in sprite order, each
+// sprite as a chain linked through the frame headers. The colour streams of
+// all frames share one vocabulary built from their contents.
+func (encoder *Encoder) Encode(sprites []Sprite) error {
+	if len(sprites) > math.MaxInt16 {
+		return fmt.Errorf("gp: too many sprites: %d", len(sprites))
+	}
+
+	chains := make([][]*encodedFrame, len(sprites))
+	var samples [][]byte
+	for si := range sprites {
+		for fi, frame := range sprites[si].Frames {
+			ef, err := encoder.encodeFrame(frame)
+			if err != nil {
+				return fmt.Errorf("gp: sprite %d frame %d: %w", si, fi, err)
+			}
+			chains[si] = append(chains[si], ef)
+			samples = append(samples, ef.colors)
+		}
+	}
+
+	voc := lzstd.BuildVocabulary(samples, lzstd.MaxVocabulary)
+	packer := lzstd.NewEncoder(voc)
+
+	h := header{
+		Sign:          signature,
+		PicturesCount: int16(len(sprites)),
+		VocLength:     uint16(len(voc)),
+	}
+	offset := int64(binary.Size(h)) + 4*int64(len(sprites))
+	h.VocOffset = uint32(offset)
+	offset += int64(len(voc))
+
+	pictures := make([]uint32, len(sprites))
+	for si, chain := range chains {
+		pictures[si] = uint32(offset)
+		for fi, ef := range chain {
+			ef.pack(packer, fi == len(chain)-1)
+			offset += int64(len(ef.data))
+		}
+		if offset > math.MaxUint32 {
+			return ErrFrameTooLarge
+		}
+	}
+	// Sprites without frames point past the last frame, where the decoder
+	// finds no frame header and ends the chain.
+	for si := range sprites {
+		if len(chains[si]) == 0 {
+			pictures[si] = uint32(offset)
+		}
+	}
+
+	bw := bufio.NewWriter(encoder.w)
+	if err := binary.Write(bw, binary.LittleEndian, &h); err != nil {
+		return err
+	}
+	if err := binary.Write(bw, binary.LittleEndian, pictures); err != nil {
+		return err
+	}
+	if _, err := bw.Write(voc); err != nil {
+		return err
+	}
+	for _, chain := range chains {
+		for _, ef := range chain {
+			if _, err := bw.Write(ef.data); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+type encodedFrame struct {
+	header frameHeader
+	shape  []byte
+	colors []byte
+	data   []byte
+}
+
+func (encoder *Encoder) encodeFrame(frame *Frame) (*encodedFrame, error) {
+	if frame == nil || frame.Image == nil {
+		return nil, ErrNoImage
+	}
+	b := frame.Image.Bounds()
+	if b.Dx() > math.MaxInt16 || b.Dy() > math.MaxInt16 {
+		return nil, ErrFrameTooLarge
+	}
+
+	shadow := frame.Type() == ShadowFrame
+	var indices []int
+	var err error
+	if shadow {
+		indices = coverage(frame)
+	} else if indices, err = encoder.indices(frame.Image); err != nil {
+		return nil, err
+	}
+
+	ef := &encodedFrame{}
+	for y := 0; y < b.Dy(); y++ {
+		row := indices[y*b.Dx() : (y+1)*b.Dx()]
+		var runs []run
+		x, end := 0, 0
+		for x < len(row) {
+			if row[x] < 0 {
+				x++
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] >= 0 {
+				if !shadow {
+					ef.colors = append(ef.colors, uint8(row[x]))
+				}
+				x++
+			}
+			runs = append(runs, run{space: start - end, pixels: x - start})
+			end = x
+		}
+		if ef.shape, err = appendLine(ef.shape, runs); err != nil {
+			return nil, fmt.Errorf("line %d: %w", y, err)
+		}
+	}
+
+	coff := frameHeaderSize + len(ef.shape)
+	if len(ef.colors) > maxColorLength || coff > maxColorOffset {
+		return nil, ErrFrameTooLarge
+	}
+
+	ef.header = frame.header
+	ef.header.Lx, ef.header.Ly, ef.header.Lines = int16(b.Dx()), int16(b.Dy()), int16(b.Dy())
+	ef.header.Options = uint8(frame.Type()) | uint8(coff>>14)<<6
+	ef.header.CData = uint32(len(ef.colors))<<14 | uint32(coff&0x3FFF)
+	return ef, nil
+}
+
+func (ef *encodedFrame) pack(packer *lzstd.Encoder, last bool) {
+	coff := frameHeaderSize + len(ef.shape)
+	ef.data = make([]byte, 0, coff+len(ef.colors)+len(ef.colors)/8+1)
+	ef.data, _ = binary.Append(ef.data, binary.LittleEndian, &ef.header)
+	ef.data = append(ef.data, ef.shape...)
+	ef.data = packer.Encode(ef.data, ef.colors)
+
+	next := int32(-1)
+	if !last {
+		next = int32(len(ef.data))
+	}
+	binary.LittleEndian.PutUint32(ef.data[0:], uint32(next))
+}
+
+// indices maps every pixel of img to a palette index, or -1 where the pixel
+// is transparent. Paletted images keep their own indices; other images are
+// mapped to the nearest colour of the encoder palette.
+func (encoder *Encoder) indices(img image.Image) ([]int, error) {
+	b := img.Bounds()
+	indices := make([]int, 0, b.Dx()*b.Dy())
+
+	if p, ok := img.(*image.Paletted); ok {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				idx := p.ColorIndexAt(x, y)
+				if int(idx) < len(p.Palette) {
+					if _, _, _, a := p.Palette[idx].RGBA(); a == 0 {
+						indices = append(indices, -1)
+						continue
+					}
+				}
+				indices = append(indices, int(idx))
+			}
+		}
+		return indices, nil
+	}
+
+	if len(encoder.palette) == 0 {
+		return nil, ErrNoPalette
+	}
+	cache := make(map[color.RGBA64]int)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.RGBA64Model.Convert(img.At(x, y)).(color.RGBA64)
+			if c.A < 0x8000 {
+				indices = append(indices, -1)
+				continue
+			}
+			idx, ok := cache[c]
+			if !ok {
+				idx = encoder.palette.Index(c)
+				cache[c] = idx
+			}
+			indices = append(indices, idx)
+		}
+	}
+	return indices, nil
+}
+
+// coverage marks the pixels a shadow frame darkens with 0 and the rest with
+// -1. The frame Mask is used when set, the image alpha otherwise.
+func coverage(frame *Frame) []int {
+	b := frame.Image.Bounds()
+	indices := make([]int, 0, b.Dx()*b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			var a uint32
+			if frame.Mask != nil {
+				mb := frame.Mask.Bounds()
+				a = uint32(frame.Mask.AlphaAt(mb.Min.X+x-b.Min.X, mb.Min.Y+y-b.Min.Y).A)
+			} else {
+				_, _, _, a = frame.Image.At(x, y).RGBA()
+			}
+			if a == 0 {
+				indices = append(indices, -1)
+			} else {
+				indices = append(indices, 0)
+			}
+		}
+	}
+	return indices
+}
+
+type run struct {
+	space  int
+	pixels int
+}
+
+// appendLine encodes one line of the shape: a zero byte for an empty line,
+// the packed form (0x80 | flags | count, then one space/pixels nibble pair
+// per run) when every run fits it, and space/pixels byte pairs otherwise.
+func appendLine(dst []byte, runs []run) ([]byte, error) {
+	if len(runs) == 0 {
+		return append(dst, 0), nil
+	}
+	if cmd, ok := shortLine(runs); ok {
+		dst = append(dst, cmd)
+		for _, r := range runs {
+			dst = append(dst, byte(r.space&0x0F)|byte(r.pixels&0x0F)<<4)
+		}
+		return dst, nil
+	}
+
+	var pairs []byte
+	for _, r := range runs {
+		space, pixels := r.space, r.pixels
+		for space > 0xFF {
+			pairs = append(pairs, 0xFF, 0)
+			space -= 0xFF
+		}
+		for pixels > 0xFF {
+			pairs = append(pairs, byte(space), 0xFF)
+			space, pixels = 0, pixels-0xFF
+		}
+		pairs = append(pairs, byte(space), byte(pixels))
+	}
+	if len(pairs)/2 > maxLongPairs {
+		return nil, ErrFrameTooLarge
+	}
+	dst = append(dst, byte(len(pairs)/2))
+	return append(dst, pairs...), nil
+}
+
+func shortLine(runs []run) (byte, bool) {
+	if len(runs) > maxShortPacks {
+		return 0, false
+	}
+	spaceHigh, pixelsHigh := runs[0].space>>4, runs[0].pixels>>4
+	for _, r := range runs {
+		if r.space > 0x1F || r.pixels > 0x1F || r.space>>4 != spaceHigh || r.pixels>>4 != pixelsHigh {
+			return 0, false
+		}
+	}
+	cmd := byte(0x80) | byte(len(runs))
+	if spaceHigh != 0 {
+		cmd |= 0x40
+	}
+	if pixelsHigh != 0 {
+		cmd |= 0x20
+	}
+	return cmd, true
+}
@@ -0,0 +1,147 @@
+package gp
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// lineImage returns a one-row-per-line image drawing each line as the given
+// runs, with colour indices counting up from 1.
+func lineImage(palette color.Palette, w int, lines ...[]run) *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, w, len(lines)), append(color.Palette{color.Transparent}, palette[1:]...))
+	c := 0
+	for y, runs := range lines {
+		x := 0
+		for _, r := range runs {
+			x += r.space
+			for i := 0; i < r.pixels; i++ {
+				img.SetColorIndex(x, y, uint8(1+c%255))
+				x++
+				c++
+			}
+		}
+	}
+	return img
+}
+
+func TestEncodeLines(t *testing.T) {
+	palette := testPalette()
+	for _, tc := range []struct {
+		name  string
+		w     int
+		runs  []run
+		short bool
+	}{
+		{"empty", 8, nil, false},
+		{"short", 40, []run{{0, 3}, {2, 1}, {5, 15}}, true},
+		{"short high nibbles", 90, []run{{16, 17}, {20, 31}}, true},
+		{"mixed nibbles", 80, []run{{1, 2}, {20, 31}}, false},
+		{"long runs", 900, []run{{300, 256}, {0x20, 0x20}}, false},
+		{"long space", 700, []run{{600, 1}, {1, 3}}, false},
+		{"full width", 600, []run{{0, 600}}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			line, err := appendLine(nil, tc.runs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if short := line[0]&0x80 != 0; short != tc.short {
+				t.Fatalf("line %x: short form = %v, want %v", line, short, tc.short)
+			}
+
+			// The shape walks back to the same runs.
+			var got []run
+			end := 0
+			walkLines(line, 1, tc.w, func(x, _, n int) bool {
+				if len(got) > 0 && x == end {
+					got[len(got)-1].pixels += n
+				} else {
+					got = append(got, run{space: x - end, pixels: n})
+				}
+				end = x + n
+				return true
+			})
+			if len(got) != len(tc.runs) {
+				t.Fatalf("runs = %v, want %v", got, tc.runs)
+			}
+			for i := range got {
+				if got[i] != tc.runs[i] {
+					t.Fatalf("runs = %v, want %v", got, tc.runs)
+				}
+			}
+
+			img := lineImage(palette, tc.w, tc.runs, tc.runs)
+			frame := decodeFrame(t, StandardFrame, img, image.Pt(-3, 5), WithPaletted(0), WithStrict())
+			if !bytes.Equal(frame.Image.(*image.Paletted).Pix, img.Pix) {
+				t.Fatal("decoded pixels differ")
+			}
+		})
+	}
+}
+
+func TestEncodeFrameTypes(t *testing.T) {
+	palette := testPalette()
+	img := lineImage(palette, 300, []run{{0, 3}, {2, 1}}, nil, []run{{270, 29}}, []run{{1, 1}, {20, 280}})
+	for _, frameType := range []FrameType{StandardFrame, NationalMaskFrame, Transparent50Frame, Transparent75Frame, ShadowFrame} {
+		frame := decodeFrame(t, frameType, img, image.Pt(-3, 5), WithPaletted(0), WithStrict())
+		if frameType == ShadowFrame {
+			for i, idx := range img.Pix {
+				if drawn := frame.Mask.Pix[i] != 0; drawn != (idx != 0) {
+					t.Fatalf("shadow: pixel %d drawn = %v, want %v", i, drawn, idx != 0)
+				}
+			}
+			continue
+		}
+		if !bytes.Equal(frame.Image.(*image.Paletted).Pix, img.Pix) {
+			t.Fatalf("type %d: decoded pixels differ", frameType)
+		}
+	}
+}
+
+func TestEncodeTooManyRuns(t *testing.T) {
+	runs := make([]run, maxLongPairs+1)
+	for i := range runs {
+		runs[i] = run{space: 1, pixels: 0x20}
+	}
+	if _, err := appendLine(nil, runs); err != ErrFrameTooLarge {
+		t.Fatalf("err = %v, want %v", err, ErrFrameTooLarge)
+	}
+}
+
+func TestNationalMask(t *testing.T) {
+	palette := testPalette()
+	img := testImage(palette)
+	data := encode(t, Sprite{Frames: []*Frame{NewTypedFrame(NationalMaskFrame, img, image.Point{})}})
+
+	const first, count = 40, 60
+	for _, opts := range [][]Option{nil, {WithPaletted(0)}} {
+		decoder, err := NewDecoder(bytes.NewReader(data), palette, append(opts, WithNationalColors(first, count))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		frame := decoder.Sprites[0].Frames[0]
+		marked := 0
+		for i, idx := range img.Pix {
+			national := idx >= first && idx < first+count
+			if got := frame.Mask.Pix[i] != 0; got != national {
+				t.Fatalf("pixel %d with index %d: marked = %v, want %v", i, idx, got, national)
+			}
+			if national {
+				marked++
+			}
+		}
+		if marked == 0 {
+			t.Fatal("no pixel uses a national colour")
+		}
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(data), palette)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame := decoder.Sprites[0].Frames[0]; frame.Mask != nil || frame.Image == nil {
+		t.Fatal("without WithNationalColors the frame should decode without a mask")
+	}
+}
@@ -0,0 +1,225 @@
+package gp
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+	"sort"
+	"time"
+)
+
+var (
+	ErrEmptySprite = errors.New("gp: sprite has no frames")
+)
+
+// AtlasFrame locates one frame inside a sprite sheet. X, Y, W and H give its
+// rectangle in the sheet, Dx and Dy the frame offset inside the sprite.
+type AtlasFrame struct {
+	Sprite int `json:"sprite"`
+	Frame  int `json:"frame"`
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	W      int `json:"w"`
+	H      int `json:"h"`
+	Dx     int `json:"dx"`
+	Dy     int `json:"dy"`
+}
+
+type Atlas struct {
+	Width  int          `json:"width"`
+	Height int          `json:"height"`
+	Frames []AtlasFrame `json:"frames"`
+}
+
+const sheetPadding = 1
+
+// NewSheet packs every decoded frame of sprites into a single image using
+// shelf packing no wider than maxWidth, and returns it with its atlas.
+func NewSheet(sprites []Sprite, maxWidth int) (*image.RGBA, *Atlas) {
+	type item struct {
+		AtlasFrame
+		img image.Image
+	}
+	var items []*item
+	for si := range sprites {
+		for fi, frame := range sprites[si].Frames {
+			if frame == nil || frame.Image == nil {
+				continue
+			}
+			b := frame.Image.Bounds()
+			offset := frame.Rect().Min
+			items = append(items, &item{
+				AtlasFrame: AtlasFrame{
+					Sprite: si, Frame: fi,
+					W: b.Dx(), H: b.Dy(),
+					Dx: offset.X, Dy: offset.Y,
+				},
+				img: frame.Image,
+			})
+		}
+	}
+
+	order := make([]*item, len(items))
+	copy(order, items)
+	sort.SliceStable(order, func(i, j int) bool { return order[i].H > order[j].H })
+
+	atlas := &Atlas{}
+	x, y, shelf := 0, 0, 0
+	for _, it := range order {
+		if x > 0 && x+it.W > maxWidth {
+			x, y, shelf = 0, y+shelf+sheetPadding, 0
+		}
+		it.X, it.Y = x, y
+		x += it.W + sheetPadding
+		shelf = max(shelf, it.H)
+		atlas.Width = max(atlas.Width, it.X+it.W)
+		atlas.Height = max(atlas.Height, it.Y+it.H)
+	}
+
+	sheet := image.NewRGBA(image.Rect(0, 0, atlas.Width, atlas.Height))
+	for _, it := range items {
+		r := image.Rect(it.X, it.Y, it.X+it.W, it.Y+it.H)
+		draw.Draw(sheet, r, it.img, it.img.Bounds().Min, draw.Src)
+		atlas.Frames = append(atlas.Frames, it.AtlasFrame)
+	}
+	return sheet, atlas
+}
+
+// frameCanvas returns frame i of the sprite drawn on a fresh sprite canvas.
+func (sprite *Sprite) frameCanvas(i int) (*image.RGBA, error) {
+	canvas := sprite.Canvas().(*image.RGBA)
+	return canvas, sprite.Compose(i, canvas, image.Point{}, nil)
+}
+
+// EncodeGIF writes the sprite frames, composited on the sprite canvas, as an
+// endlessly looping animated GIF. Transparent pixels use a dedicated entry
+// prepended to palette, so only its first 255 colours are kept.
+func EncodeGIF(w io.Writer, sprite *Sprite, palette color.Palette, delay time.Duration) error {
+	if len(sprite.Frames) == 0 || sprite.Rect().Empty() {
+		return ErrEmptySprite
+	}
+	p := color.Palette{color.Transparent}
+	p = append(p, palette[:min(len(palette), 255)]...)
+
+	anim := &gif.GIF{}
+	for i := range sprite.Frames {
+		canvas, err := sprite.frameCanvas(i)
+		if err != nil {
+			return err
+		}
+		// GIF frames cannot start left of or above the origin.
+		img := image.NewPaletted(image.Rect(0, 0, canvas.Bounds().Dx(), canvas.Bounds().Dy()), p)
+		draw.Draw(img, img.Bounds(), canvas, canvas.Bounds().Min, draw.Src)
+		anim.Image = append(anim.Image, img)
+		anim.Delay = append(anim.Delay, int(delay/(10*time.Millisecond)))
+		anim.Disposal = append(anim.Disposal, gif.DisposalBackground)
+	}
+	return gif.EncodeAll(w, anim)
+}
+
+// EncodeAPNG writes the sprite frames, composited on the sprite canvas, as an
+// endlessly looping animated PNG with 8-bit RGBA pixels.
+func EncodeAPNG(w io.Writer, sprite *Sprite, delay time.Duration) error {
+	rect := sprite.Rect()
+	if len(sprite.Frames) == 0 || rect.Empty() {
+		return ErrEmptySprite
+	}
+	aw := &apngWriter{w: w}
+
+	aw.write([]byte("\x89PNG\r\n\x1a\n"))
+
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], uint32(rect.Dx()))
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(rect.Dy()))
+	ihdr[8] = 8 // bit depth
+	ihdr[9] = 6 // truecolour with alpha
+	aw.chunk("IHDR", ihdr)
+
+	actl := make([]byte, 8)
+	binary.BigEndian.PutUint32(actl[0:], uint32(len(sprite.Frames)))
+	aw.chunk("acTL", actl)
+
+	seq := uint32(0)
+	for i := range sprite.Frames {
+		fctl := make([]byte, 26)
+		binary.BigEndian.PutUint32(fctl[0:], seq)
+		binary.BigEndian.PutUint32(fctl[4:], uint32(rect.Dx()))
+		binary.BigEndian.PutUint32(fctl[8:], uint32(rect.Dy()))
+		binary.BigEndian.PutUint16(fctl[20:], uint16(delay/time.Millisecond))
+		binary.BigEndian.PutUint16(fctl[22:], 1000)
+		fctl[24] = 1 // dispose to background
+		aw.chunk("fcTL", fctl)
+		seq++
+
+		canvas, err := sprite.frameCanvas(i)
+		if err != nil {
+			return err
+		}
+		data, err := deflateRGBA(canvas)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			aw.chunk("IDAT", data)
+		} else {
+			fdat := make([]byte, 4, 4+len(data))
+			binary.BigEndian.PutUint32(fdat, seq)
+			aw.chunk("fdAT", append(fdat, data...))
+			seq++
+		}
+	}
+	aw.chunk("IEND", nil)
+	return aw.err
+}
+
+type apngWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (aw *apngWriter) write(p []byte) {
+	if aw.err != nil {
+		return
+	}
+	_, aw.err = aw.w.Write(p)
+}
+
+func (aw *apngWriter) chunk(name string, data []byte) {
+	var head [8]byte
+	binary.BigEndian.PutUint32(head[:4], uint32(len(data)))
+	copy(head[4:], name)
+	crc := crc32.NewIEEE()
+	crc.Write(head[4:])
+	crc.Write(data)
+	aw.write(head[:])
+	aw.write(data)
+	aw.write(binary.BigEndian.AppendUint32(nil, crc.Sum32()))
+}
+
+func deflateRGBA(img *image.RGBA) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	b := img.Bounds()
+	row := make([]byte, 1+4*b.Dx())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			i := 1 + 4*(x-b.Min.X)
+			row[i], row[i+1], row[i+2], row[i+3] = c.R, c.G, c.B, c.A
+		}
+		if _, err := zw.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,201 @@
+package gp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+	"time"
+)
+
+// testSprite returns a sprite of three frames at different offsets, one of
+// them left of and above the sprite origin.
+func testSprite() *Sprite {
+	palette := testPalette()
+	return &Sprite{Frames: []*Frame{
+		NewFrame(testImage(palette), image.Pt(0, 0)),
+		NewFrame(testImage(palette), image.Pt(3, 1)),
+		NewFrame(testImage(palette), image.Pt(-2, -4)),
+	}}
+}
+
+// checkCanvas compares img, whose origin is the top-left corner of the
+// sprite, with frame i composited on the sprite canvas.
+func checkCanvas(t *testing.T, sprite *Sprite, i int, img image.Image) {
+	t.Helper()
+	canvas, err := sprite.frameCanvas(i)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := canvas.Bounds()
+	if img.Bounds().Size() != b.Size() {
+		t.Fatalf("frame %d: size = %v, want %v", i, img.Bounds().Size(), b.Size())
+	}
+	ib := img.Bounds()
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			got := color.NRGBAModel.Convert(img.At(ib.Min.X+x, ib.Min.Y+y)).(color.NRGBA)
+			want := color.NRGBAModel.Convert(canvas.At(b.Min.X+x, b.Min.Y+y)).(color.NRGBA)
+			if got.A == 0 && want.A == 0 {
+				continue
+			}
+			if got != want {
+				t.Fatalf("frame %d: pixel (%d, %d) = %v, want %v", i, x, y, got, want)
+			}
+		}
+	}
+}
+
+type pngChunk struct {
+	name string
+	data []byte
+}
+
+func readChunks(t *testing.T, data []byte) []pngChunk {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")) {
+		t.Fatal("missing PNG signature")
+	}
+	var chunks []pngChunk
+	for p := data[8:]; len(p) > 0; {
+		if len(p) < 12 {
+			t.Fatalf("truncated chunk: %d bytes left", len(p))
+		}
+		n := binary.BigEndian.Uint32(p)
+		if int(n)+12 > len(p) {
+			t.Fatalf("chunk %q runs past the end", p[4:8])
+		}
+		c := pngChunk{name: string(p[4:8]), data: p[8 : 8+n]}
+		if crc32.ChecksumIEEE(p[4:8+n]) != binary.BigEndian.Uint32(p[8+n:]) {
+			t.Fatalf("chunk %q: bad CRC", c.name)
+		}
+		chunks = append(chunks, c)
+		p = p[12+n:]
+	}
+	return chunks
+}
+
+func TestEncodeAPNG(t *testing.T) {
+	sprite := testSprite()
+	var buf bytes.Buffer
+	if err := EncodeAPNG(&buf, sprite, 120*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	rect := sprite.Rect()
+	var fctl, fdat, idat int
+	seq := uint32(0)
+	for _, c := range readChunks(t, buf.Bytes()) {
+		switch c.name {
+		case "acTL":
+			if frames := binary.BigEndian.Uint32(c.data); frames != 3 {
+				t.Fatalf("acTL frames = %d, want 3", frames)
+			}
+			if plays := binary.BigEndian.Uint32(c.data[4:]); plays != 0 {
+				t.Fatalf("acTL plays = %d, want 0", plays)
+			}
+		case "fcTL":
+			fctl++
+			if got := binary.BigEndian.Uint32(c.data); got != seq {
+				t.Fatalf("fcTL sequence = %d, want %d", got, seq)
+			}
+			seq++
+			w, h := binary.BigEndian.Uint32(c.data[4:]), binary.BigEndian.Uint32(c.data[8:])
+			if int(w) != rect.Dx() || int(h) != rect.Dy() {
+				t.Fatalf("fcTL size = %dx%d, want %v", w, h, rect.Size())
+			}
+			num, den := binary.BigEndian.Uint16(c.data[20:]), binary.BigEndian.Uint16(c.data[22:])
+			if num != 120 || den != 1000 {
+				t.Fatalf("fcTL delay = %d/%d, want 120/1000", num, den)
+			}
+		case "fdAT":
+			fdat++
+			if got := binary.BigEndian.Uint32(c.data); got != seq {
+				t.Fatalf("fdAT sequence = %d, want %d", got, seq)
+			}
+			seq++
+		case "IDAT":
+			idat++
+		}
+	}
+	if fctl != 3 || fdat != 2 || idat != 1 {
+		t.Fatalf("fcTL %d, fdAT %d, IDAT %d; want 3, 2, 1", fctl, fdat, idat)
+	}
+
+	// Decoders without APNG support show the first frame.
+	img, err := png.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCanvas(t, sprite, 0, img)
+}
+
+func TestEncodeGIF(t *testing.T) {
+	sprite := testSprite()
+	var buf bytes.Buffer
+	if err := EncodeGIF(&buf, sprite, testPalette(), 120*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	anim, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Image) != 3 {
+		t.Fatalf("%d frames, want 3", len(anim.Image))
+	}
+	for i, img := range anim.Image {
+		if anim.Delay[i] != 12 {
+			t.Errorf("frame %d: delay = %d, want 12", i, anim.Delay[i])
+		}
+		checkCanvas(t, sprite, i, img)
+	}
+}
+
+func TestEncodeEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := EncodeAPNG(&buf, &Sprite{}, time.Second); !errors.Is(err, ErrEmptySprite) {
+		t.Errorf("EncodeAPNG: err = %v, want %v", err, ErrEmptySprite)
+	}
+	if err := EncodeGIF(&buf, &Sprite{}, testPalette(), time.Second); !errors.Is(err, ErrEmptySprite) {
+		t.Errorf("EncodeGIF: err = %v, want %v", err, ErrEmptySprite)
+	}
+}
+
+func TestNewSheet(t *testing.T) {
+	sprites := []Sprite{*testSprite(), *testSprite()}
+	sheet, atlas := NewSheet(sprites, 30)
+
+	if len(atlas.Frames) != 6 {
+		t.Fatalf("%d atlas frames, want 6", len(atlas.Frames))
+	}
+	if atlas.Width > 30 || sheet.Bounds() != image.Rect(0, 0, atlas.Width, atlas.Height) {
+		t.Fatalf("sheet %v, atlas %dx%d, max width 30", sheet.Bounds(), atlas.Width, atlas.Height)
+	}
+	for i, f := range atlas.Frames {
+		r := image.Rect(f.X, f.Y, f.X+f.W, f.Y+f.H)
+		for _, g := range atlas.Frames[i+1:] {
+			if r.Overlaps(image.Rect(g.X, g.Y, g.X+g.W, g.Y+g.H)) {
+				t.Fatalf("frames %+v and %+v overlap", f, g)
+			}
+		}
+		frame := sprites[f.Sprite].Frames[f.Frame]
+		if offset := frame.Rect().Min; f.Dx != offset.X || f.Dy != offset.Y {
+			t.Errorf("frame %d/%d: offset = (%d, %d), want %v", f.Sprite, f.Frame, f.Dx, f.Dy, offset)
+		}
+		fb := frame.Image.Bounds()
+		for y := 0; y < f.H; y++ {
+			for x := 0; x < f.W; x++ {
+				got := color.NRGBAModel.Convert(sheet.At(f.X+x, f.Y+y))
+				want := color.NRGBAModel.Convert(frame.Image.At(fb.Min.X+x, fb.Min.Y+y))
+				if got != want {
+					t.Fatalf("frame %d/%d: pixel (%d, %d) = %v, want %v", f.Sprite, f.Frame, x, y, got, want)
+				}
+			}
+		}
+	}
+}
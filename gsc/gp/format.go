@@ -0,0 +1,110 @@
+package gp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io"
+	"sync"
+
+	"gitgub.com/cam-per/gossacks/gsc"
+)
+
+var (
+	imagePaletteMu sync.RWMutex
+	imagePalette   = grayPalette()
+)
+
+// SetImagePalette sets the palette image.Decode draws GP files with. The
+// default maps every index to the grey of that level. The images decoded
+// hold the raw colour indices, so they can also be repainted afterwards.
+func SetImagePalette(palette color.Palette) {
+	imagePaletteMu.Lock()
+	defer imagePaletteMu.Unlock()
+	imagePalette = append(color.Palette(nil), palette...)
+}
+
+// ImagePalette returns a copy of the palette image.Decode draws GP files with.
+func ImagePalette() color.Palette {
+	imagePaletteMu.RLock()
+	defer imagePaletteMu.RUnlock()
+	return append(color.Palette(nil), imagePalette...)
+}
+
+func grayPalette() color.Palette {
+	p := make(color.Palette, 256)
+	for i := range p {
+		p[i] = color.Gray{Y: uint8(i)}
+	}
+	return p
+}
+
+func init() {
+	gsc.RegisterFormat(gsc.Format{
+		Name:       "gp",
+		Extensions: []string{".gp"},
+		Sniff:      gsc.Magic(string(signature[:])),
+	})
+	image.RegisterFormat("gp", string(signature[:]), decodeImage, decodeConfig)
+}
+
+// decodeImage returns the first frame of the first sprite, paletted with
+// index 0 transparent. Shadow frames decode to NRGBA.
+func decodeImage(r io.Reader) (image.Image, error) {
+	decoder, err := NewDecoder(r, ImagePalette(), WithPaletted(0))
+	if err != nil {
+		return nil, err
+	}
+	if len(decoder.Sprites) == 0 || len(decoder.Sprites[0].Frames) == 0 {
+		return nil, ErrEmptySprite
+	}
+	for _, problem := range decoder.Problems() {
+		if problem.Sprite == 0 && problem.Frame == 0 {
+			return nil, problem
+		}
+	}
+	frame := decoder.Sprites[0].Frames[0]
+	if frame.Image == nil {
+		return nil, ErrEmptySprite
+	}
+	return frame.Image, nil
+}
+
+// decodeConfig reads the size and type of the frame decodeImage returns.
+func decodeConfig(r io.Reader) (image.Config, error) {
+	br := bufio.NewReader(r)
+	var h header
+	if err := binary.Read(br, binary.LittleEndian, &h); err != nil {
+		return image.Config{}, err
+	}
+	if h.PicturesCount <= 0 {
+		return image.Config{}, ErrEmptySprite
+	}
+	var first uint32
+	if err := binary.Read(br, binary.LittleEndian, &first); err != nil {
+		return image.Config{}, err
+	}
+	skip := int64(first) - int64(binary.Size(h)) - 4
+	if skip < 0 {
+		return image.Config{}, io.ErrUnexpectedEOF
+	}
+	if _, err := br.Discard(int(skip)); err != nil {
+		return image.Config{}, err
+	}
+	var fh frameHeader
+	if err := binary.Read(br, binary.LittleEndian, &fh); err != nil {
+		return image.Config{}, err
+	}
+
+	frame := &Frame{header: fh}
+	var model color.Model = color.NRGBAModel
+	if frame.Type() != ShadowFrame {
+		model = framePalette(ImagePalette(), 0, frame.Type().Opacity())
+	}
+	return image.Config{
+		ColorModel: model,
+		Width:      int(fh.Lx),
+		Height:     int(fh.Ly),
+	}, nil
+}
@@ -0,0 +1,129 @@
+package gp
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"gitgub.com/cam-per/gossacks/gsc"
+)
+
+// formatSprite returns a sprite whose first frame, the one image.Decode
+// returns, is of type frameType.
+func formatSprite(frameType FrameType) Sprite {
+	palette := testPalette()
+	return Sprite{Frames: []*Frame{
+		NewTypedFrame(frameType, testImage(palette), image.Pt(2, 3)),
+		NewFrame(image.NewPaletted(image.Rect(0, 0, 1, 1), palette), image.Point{}),
+	}}
+}
+
+func TestImageDecode(t *testing.T) {
+	for _, tc := range []struct {
+		frameType FrameType
+		paletted  bool
+		alpha     uint8
+	}{
+		{StandardFrame, true, 0xFF},
+		{Transparent50Frame, true, 0x80},
+		{Transparent75Frame, true, 0xC0},
+		{ShadowFrame, false, 0x80},
+	} {
+		data := encode(t, formatSprite(tc.frameType))
+
+		config, name, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != "gp" || config.Width != 12 || config.Height != 8 {
+			t.Fatalf("type %d: DecodeConfig = %q %dx%d", tc.frameType, name, config.Width, config.Height)
+		}
+
+		img, name, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != "gp" || img.Bounds() != image.Rect(0, 0, 12, 8) {
+			t.Fatalf("type %d: Decode = %q %v", tc.frameType, name, img.Bounds())
+		}
+		if _, ok := img.(*image.Paletted); ok != tc.paletted {
+			t.Fatalf("type %d: decoded to %T", tc.frameType, img)
+		}
+
+		// The reported model is the one of the image, keeping the alpha of
+		// translucent frames.
+		if !sameModel(config.ColorModel, img.ColorModel()) {
+			t.Fatalf("type %d: config model differs from the image model", tc.frameType)
+		}
+		c := color.NRGBAModel.Convert(img.At(1, 0)).(color.NRGBA)
+		if c.A != tc.alpha {
+			t.Errorf("type %d: alpha = %#x, want %#x", tc.frameType, c.A, tc.alpha)
+		}
+		if _, _, _, a := img.At(0, 0).RGBA(); a != 0 {
+			t.Errorf("type %d: transparent pixel has alpha %#x", tc.frameType, a)
+		}
+	}
+}
+
+func TestImagePalette(t *testing.T) {
+	defer SetImagePalette(ImagePalette())
+	data := encode(t, formatSprite(StandardFrame))
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := img.At(1, 0), (color.Gray{Y: 1 + 20}); got != want {
+		t.Fatalf("default palette: pixel = %v, want %v", got, want)
+	}
+
+	palette := testPalette()
+	SetImagePalette(palette)
+	palette[21] = color.Black
+	if got := ImagePalette()[21]; got == color.Black {
+		t.Fatal("SetImagePalette kept the caller's slice")
+	}
+	ImagePalette()[21] = color.Black
+	img, _, err = image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := img.At(1, 0), testPalette()[21]; got != want {
+		t.Fatalf("pixel = %v, want %v", got, want)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	data := encode(t, formatSprite(StandardFrame))
+	for _, name := range []string{"unit.gp", "unit.bin", ""} {
+		f, err := gsc.Detect(bytes.NewReader(data), name)
+		if err != nil || f.Name != "gp" {
+			t.Errorf("Detect(%q) = %q, %v", name, f.Name, err)
+		}
+	}
+	if f, err := gsc.Detect(bytes.NewReader([]byte("not a sprite")), "unit.gp"); err != nil || f.Name != "gp" {
+		t.Errorf("Detect by extension = %q, %v", f.Name, err)
+	}
+	if _, err := gsc.Detect(bytes.NewReader([]byte("not a sprite")), "unit.xyz"); err != gsc.ErrUnknownFormat {
+		t.Errorf("Detect unknown: err = %v, want %v", err, gsc.ErrUnknownFormat)
+	}
+}
+
+func sameModel(a, b color.Model) bool {
+	pa, ok := a.(color.Palette)
+	if !ok {
+		_, ok = b.(color.Palette)
+		return !ok && a == b
+	}
+	pb, ok := b.(color.Palette)
+	if !ok || len(pa) != len(pb) {
+		return false
+	}
+	for i := range pa {
+		if pa[i] != pb[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -3,6 +3,7 @@ package gp
 import (
 	"encoding/binary"
 	"image"
+	"image/color"
 	"image/draw"
 )
 
@@ -35,6 +36,18 @@ const (
 	InvalidFrame       FrameType = 0xff
 )
 
+// Opacity returns the alpha the pixels of frames of type t are drawn with.
+func (t FrameType) Opacity() uint8 {
+	switch t {
+	case Transparent50Frame:
+		return 0x80
+	case Transparent75Frame:
+		return 0xC0
+	default:
+		return 0xFF
+	}
+}
+
 type ImageType uint8
 
 const (
@@ -46,9 +59,38 @@ const (
 
 type Frame struct {
 	image.Image
-	header    frameHeader
-	offset    int64
-	lineFlags []byte
+	// Mask marks the pixels of a NationalMaskFrame drawn with an index of
+	// the run set by WithNationalColors, or the pixels a ShadowFrame darkens.
+	// It is nil for other frame types.
+	Mask        *image.Alpha
+	header      frameHeader
+	offset      int64
+	transparent uint8
+}
+
+// Repaint returns the frame drawn with palette instead of the one it was
+// decoded with. It shares the colour indices of the frame, so it only works
+// for frames decoded with WithPaletted.
+func (frame *Frame) Repaint(palette color.Palette) (*image.Paletted, error) {
+	img, ok := frame.Image.(*image.Paletted)
+	if !ok {
+		return nil, ErrNotPaletted
+	}
+	return &image.Paletted{
+		Pix:     img.Pix,
+		Stride:  img.Stride,
+		Rect:    img.Rect,
+		Palette: framePalette(palette, frame.transparent, frame.Type().Opacity()),
+	}, nil
+}
+
+// TransparentIndex returns the index undrawn pixels hold in a frame decoded
+// with WithPaletted. ok is false for other frames.
+func (frame *Frame) TransparentIndex() (idx uint8, ok bool) {
+	if _, ok := frame.Image.(*image.Paletted); !ok {
+		return 0, false
+	}
+	return frame.transparent, true
 }
 
 func (frame *Frame) Type() FrameType { return FrameType(frame.header.Options & 0b111111) }
@@ -56,28 +98,39 @@ func (frame *Frame) Size() int       { return int(frame.header.Lx * frame.header
 
 type Sprite struct {
 	Frames []*Frame
-	rect   image.Rectangle
 }
 
-func (sprite *Sprite) Canvas() draw.Image    { return image.NewRGBA(sprite.rect) }
-func (sprite *Sprite) Rect() image.Rectangle { return sprite.rect }
+// Shadows returns the ShadowFrame frames of the sprite.
+func (sprite *Sprite) Shadows() []*Frame {
+	var shadows []*Frame
+	for _, frame := range sprite.Frames {
+		if frame.Type() == ShadowFrame {
+			shadows = append(shadows, frame)
+		}
+	}
+	return shadows
+}
+
+func (sprite *Sprite) Canvas() draw.Image { return image.NewRGBA(sprite.Rect()) }
+
+// Rect returns the union of the frame rectangles, in sprite coordinates.
+func (sprite *Sprite) Rect() image.Rectangle {
+	var rect image.Rectangle
+	for _, frame := range sprite.Frames {
+		if frame != nil {
+			rect = rect.Union(frame.Rect())
+		}
+	}
+	return rect
+}
 
+// Rect returns the area the frame covers in sprite coordinates.
 func (frame *Frame) Rect() image.Rectangle {
-	return image.Rect(
-		int(frame.header.Dx),
-		int(frame.header.Dy),
-		int(frame.header.Dx+frame.header.Lx),
-		int(frame.header.Dx+frame.header.Ly),
-	)
+	dx, dy := int(frame.header.Dx), int(frame.header.Dy)
+	return image.Rect(dx, dy, dx+int(frame.header.Lx), dy+int(frame.header.Ly))
 }
 
 func (sprite *Sprite) addFrame(frame *Frame) {
-	if x := int(frame.header.Dx + frame.header.Lx); sprite.rect.Max.X < x {
-		sprite.rect.Max.X = x
-	}
-	if y := int(frame.header.Dy + frame.header.Ly); sprite.rect.Max.Y < y {
-		sprite.rect.Max.Y = y
-	}
 	sprite.Frames = append(sprite.Frames, frame)
 }
 
@@ -0,0 +1,526 @@
+package gp
+
+import (
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"slices"
+	"sync"
+
+	"gitgub.com/cam-per/gossacks/gsc"
+	"gitgub.com/cam-per/gossacks/gsc/internal/decode"
+	"gitgub.com/cam-per/gossacks/gsc/lzstd"
+)
+
+var (
+	ErrOutOfRange  = errors.New("gp: sprite or frame index out of range")
+	ErrNotPaletted = errors.New("gp: frame was not decoded to palette indices")
+)
+
+type options struct {
+	shadowColor color.Color
+	cacheSize   int
+	paletted    bool
+	transparent uint8
+	strict      bool
+	path        string
+	nationFirst int
+	nationCount int
+	maxPixels   int64
+}
+
+// Option configures a Decoder or a Reader.
+type Option func(*options)
+
+// WithShadowColor sets the colour ShadowFrame pixels are drawn with. The
+// default is half-transparent black.
+func WithShadowColor(c color.Color) Option {
+	return func(opts *options) { opts.shadowColor = c }
+}
+
+// WithPaletted makes colour frames decode to *image.Paletted images holding
+// the raw colour indices. Pixels a frame does not draw get the transparent
+// index, whose palette entry is replaced by color.Transparent. Shadow frames
+// carry no indices and still decode to RGBA.
+func WithPaletted(transparent uint8) Option {
+	return func(opts *options) { opts.paletted, opts.transparent = true, transparent }
+}
+
+// WithCache makes a Reader keep up to n decoded frames, dropping the least
+// recently used one when full. Frames are not cached by default.
+func WithCache(n int) Option {
+	return func(opts *options) { opts.cacheSize = n }
+}
+
+// WithStrict makes decoding fail on the first problem found in the file.
+// By default broken frame chains are cut short and frames whose colours fail
+// to decode are kept, drawn up to the first broken colour, the problems
+// being recorded instead.
+func WithStrict() Option {
+	return func(opts *options) { opts.strict = true }
+}
+
+// WithNationalColors sets the run of count palette indices from first on
+// that national mask frames draw in the player colour. The Mask of those
+// frames marks the pixels drawn with an index of the run; without this
+// option it is left nil.
+func WithNationalColors(first, count int) Option {
+	return func(opts *options) { opts.nationFirst, opts.nationCount = first, count }
+}
+
+// WithMaxPixels bounds the total area of the frames of a file at n pixels;
+// frames past it are a problem, like broken ones. The default is 1<<27, and
+// n <= 0 only keeps the bound set by the file size.
+func WithMaxPixels(n int64) Option {
+	return func(opts *options) { opts.maxPixels = n }
+}
+
+// WithPath names the file in the errors reported while decoding it.
+func WithPath(name string) Option {
+	return func(opts *options) { opts.path = name }
+}
+
+type frameRef struct {
+	offset int64
+	header frameHeader
+	sprite int
+	frame  int
+}
+
+// Reader gives random access to the frames of a GP file. Open only reads the
+// file header, the picture table, the vocabulary and the frame headers;
+// frames are decoded when asked for. A Reader is safe for concurrent use when
+// its io.ReaderAt is.
+type Reader struct {
+	r       io.ReaderAt
+	data    []byte
+	size    int64
+	header  header
+	voc     []byte
+	palette color.Palette
+	options options
+	sprites [][]frameRef
+	cache   *frameCache
+
+	// rgba holds the palette as premultiplied RGBA bytes and palettes the
+	// frame palettes of paletted frames by opacity.
+	rgba     [256][4]byte
+	palettes map[uint8]color.Palette
+	buffers  sync.Pool
+
+	mu       sync.Mutex
+	problems []*decode.Error
+}
+
+// Open indexes the GP file of the given size read from r.
+func Open(r io.ReaderAt, size int64, palette color.Palette, opts ...Option) (*Reader, error) {
+	return newReader(r, nil, size, palette, opts)
+}
+
+// newReader is Open for files held in memory as data, which frames are then
+// decoded from without copying.
+func newReader(r io.ReaderAt, data []byte, size int64, palette color.Palette, opts []Option) (*Reader, error) {
+	reader := &Reader{
+		r:       r,
+		data:    data,
+		size:    size,
+		palette: palette,
+		options: options{shadowColor: color.NRGBA{A: 0x80}, maxPixels: defaultMaxPixels},
+	}
+	for _, opt := range opts {
+		opt(&reader.options)
+	}
+	if reader.options.cacheSize > 0 {
+		reader.cache = newFrameCache(reader.options.cacheSize)
+	}
+
+	for i, c := range palette[:min(len(palette), 256)] {
+		rgba := color.RGBAModel.Convert(c).(color.RGBA)
+		reader.rgba[i] = [4]byte{rgba.R, rgba.G, rgba.B, rgba.A}
+	}
+	if reader.options.paletted {
+		reader.palettes = make(map[uint8]color.Palette)
+		for _, t := range []FrameType{StandardFrame, Transparent50Frame, Transparent75Frame} {
+			a := t.Opacity()
+			reader.palettes[a] = framePalette(palette, reader.options.transparent, a)
+		}
+	}
+
+	if err := reader.index(); err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+func (reader *Reader) index() error {
+	sr := io.NewSectionReader(reader.r, 0, reader.size)
+	if err := binary.Read(sr, binary.LittleEndian, &reader.header); err != nil {
+		return reader.decodeError(-1, -1, 0, "reading file header", err)
+	}
+
+	if reader.header.PicturesCount < 0 {
+		return reader.decodeError(-1, -1, 4, fmt.Sprintf("negative picture count %d", reader.header.PicturesCount), nil)
+	}
+	pictures := make([]uint32, reader.header.PicturesCount)
+	if err := binary.Read(sr, binary.LittleEndian, &pictures); err != nil {
+		return reader.decodeError(-1, -1, int64(binary.Size(reader.header)), "reading picture table", err)
+	}
+
+	reader.voc = make([]byte, reader.header.VocLength)
+	if _, err := reader.r.ReadAt(reader.voc, int64(reader.header.VocOffset)); err != nil {
+		return reader.decodeError(-1, -1, int64(reader.header.VocOffset), "reading vocabulary", err)
+	}
+
+	// Chains may share headers, so each is bounded on its own by the room
+	// the file has for headers. Decoding allocates per frame, so the area of
+	// every frame indexed shares one bound, like the area of a single one.
+	limit := int(reader.size / int64(frameHeaderSize))
+	budget := reader.maxPixels()
+	reader.sprites = make([][]frameRef, len(pictures))
+	for i, offset := range pictures {
+		chain, err := reader.chain(i, int64(offset), limit, &budget)
+		if err != nil {
+			return err
+		}
+		reader.sprites[i] = chain
+	}
+	return nil
+}
+
+// chain follows the frame headers of sprite i starting at offset until a
+// header with no next frame, reading at most limit of them and taking the
+// area of the frames out of budget. A sprite whose first frame would start
+// at the end of the file has no frames; a chain that comes back to one of its
+// frames ends before it.
+func (reader *Reader) chain(i int, offset int64, limit int, budget *int64) ([]frameRef, error) {
+	var chain []frameRef
+	visited := make(map[int64]struct{})
+	buf := make([]byte, frameHeaderSize)
+	for {
+		if len(chain) == 0 && offset == reader.size {
+			break
+		}
+		if _, ok := visited[offset]; ok {
+			err := reader.decodeError(i, len(chain), offset, "frame chain loops", nil)
+			if err := reader.problem(err); err != nil {
+				return nil, err
+			}
+			break
+		}
+		visited[offset] = struct{}{}
+		if len(chain) >= limit {
+			err := reader.decodeError(i, len(chain), offset, "more frames than the file has room for", nil)
+			if err := reader.problem(err); err != nil {
+				return nil, err
+			}
+			break
+		}
+		if offset < 0 || offset+int64(frameHeaderSize) > reader.size {
+			err := reader.decodeError(i, len(chain), offset, "frame header outside the file", io.ErrUnexpectedEOF)
+			if err := reader.problem(err); err != nil {
+				return nil, err
+			}
+			break
+		}
+		if _, err := reader.r.ReadAt(buf, offset); err != nil {
+			return nil, reader.decodeError(i, len(chain), offset, "reading frame header", err)
+		}
+		var h frameHeader
+		if _, err := binary.Decode(buf, binary.LittleEndian, &h); err != nil {
+			return nil, reader.decodeError(i, len(chain), offset, "reading frame header", err)
+		}
+		if h.Lines != h.Ly || h.Lx < 0 || h.Ly < 0 || int64(h.Lx)*int64(h.Ly) > reader.maxPixels() {
+			reason := fmt.Sprintf("bad frame size %dx%d with %d lines", h.Lx, h.Ly, h.Lines)
+			if err := reader.problem(reader.decodeError(i, len(chain), offset, reason, nil)); err != nil {
+				return nil, err
+			}
+			break
+		}
+		area := int64(h.Lx) * int64(h.Ly)
+		if area > *budget {
+			err := reader.decodeError(i, len(chain), offset, "frames larger in total than the pixel bound", nil)
+			if err := reader.problem(err); err != nil {
+				return nil, err
+			}
+			break
+		}
+		*budget -= area
+		chain = append(chain, frameRef{offset: offset, header: h, sprite: i, frame: len(chain)})
+		if h.Next == -1 || h.Next == 0 {
+			break
+		}
+		offset += int64(h.Next)
+	}
+	return chain, nil
+}
+
+// maxPixels returns the most pixels the frames of the file may cover in
+// total.
+func (reader *Reader) maxPixels() int64 {
+	if reader.options.maxPixels <= 0 {
+		return maxPixelsPerByte * reader.size
+	}
+	return min(maxPixelsPerByte*reader.size, reader.options.maxPixels)
+}
+
+func (reader *Reader) decodeError(sprite, frame int, offset int64, reason string, err error) *decode.Error {
+	e := decode.NewError("gp", reason, err).At(offset)
+	e.Path, e.Sprite, e.Frame = reader.options.path, sprite, frame
+	return e
+}
+
+// problem returns err in strict mode. Otherwise it records err and returns
+// nil so decoding goes on.
+func (reader *Reader) problem(err *decode.Error) error {
+	if reader.options.strict {
+		return err
+	}
+	reader.mu.Lock()
+	defer reader.mu.Unlock()
+	reader.problems = append(reader.problems, err)
+	return nil
+}
+
+// Problems returns the problems recorded so far in lenient mode.
+func (reader *Reader) Problems() []*gsc.DecodeError {
+	reader.mu.Lock()
+	defer reader.mu.Unlock()
+	return slices.Clone(reader.problems)
+}
+
+// Len returns the number of sprites.
+func (reader *Reader) Len() int { return len(reader.sprites) }
+
+// Frames returns the number of frames of sprite i.
+func (reader *Reader) Frames(i int) int {
+	if i < 0 || i >= len(reader.sprites) {
+		return 0
+	}
+	return len(reader.sprites[i])
+}
+
+// Frame decodes frame j of sprite i, or returns it from the cache. When the
+// colours of the frame fail to decode it is returned drawn up to the first
+// broken colour along with a *gsc.DecodeError, and is not cached.
+//
+// Every call returns a new Frame, but with WithCache the pixels of its
+// Image and Mask are shared with the cache and every other caller of the
+// same frame, so they must not be modified.
+func (reader *Reader) Frame(i, j int) (*Frame, error) {
+	if i < 0 || i >= len(reader.sprites) || j < 0 || j >= len(reader.sprites[i]) {
+		return nil, ErrOutOfRange
+	}
+	ref := reader.sprites[i][j]
+	if frame, ok := reader.cache.get(ref.offset); ok {
+		c := *frame
+		return &c, nil
+	}
+	frame, err := reader.decodeFrame(ref)
+	if err != nil {
+		return frame, err
+	}
+	c := *frame
+	reader.cache.put(ref.offset, &c)
+	return frame, nil
+}
+
+// Sprite decodes every frame of sprite i.
+func (reader *Reader) Sprite(i int) (*Sprite, error) {
+	if i < 0 || i >= len(reader.sprites) {
+		return nil, ErrOutOfRange
+	}
+	sprite := &Sprite{}
+	for j := range reader.sprites[i] {
+		frame, err := reader.Frame(i, j)
+		if err != nil {
+			return nil, err
+		}
+		sprite.addFrame(frame)
+	}
+	return sprite, nil
+}
+
+// frameBuffers are the scratch buffers of one frame decode.
+type frameBuffers struct {
+	raw    []byte
+	colors []byte
+}
+
+func (reader *Reader) decodeFrame(ref frameRef) (*Frame, error) {
+	h := ref.header
+	frame := &Frame{
+		offset:      ref.offset,
+		header:      h,
+		transparent: reader.options.transparent,
+	}
+
+	coff := int64(h.CData & 0x3FFF)
+	if (h.Options & 64) != 0 {
+		coff += 16384
+	}
+	if (h.Options & 128) != 0 {
+		coff += 32768
+	}
+
+	clen := int64(h.CData) >> 14
+	if (h.Options & 63) == 43 {
+		clen += 262144
+	}
+	if (h.Options & 63) == 42 {
+		clen += 262144 * 2
+	}
+
+	// A line takes at most a count byte and 127 pairs; the shape ends where
+	// the colours start.
+	hsize := int64(frameHeaderSize)
+	shapeEnd := hsize + int64(h.Lines)*maxLineSize
+	if coff > hsize {
+		shapeEnd = min(shapeEnd, coff)
+	}
+	end := shapeEnd
+	colored := false
+	switch frame.Type() {
+	case StandardFrame, NationalMaskFrame, Transparent50Frame, Transparent75Frame:
+		colored = true
+	}
+	if colored {
+		// Every literal byte costs a ninth of a byte in flags.
+		end = max(end, coff+clen+clen/8+2)
+	}
+
+	buffers, _ := reader.buffers.Get().(*frameBuffers)
+	if buffers == nil {
+		buffers = &frameBuffers{}
+	}
+	defer reader.buffers.Put(buffers)
+
+	raw := reader.bytesAt(ref.offset, end, &buffers.raw)
+	shape := raw[min(hsize, int64(len(raw))):min(shapeEnd, int64(len(raw)))]
+
+	// A broken colour stream leaves the pixels past the last colour decoded
+	// undrawn.
+	var colors []byte
+	var broken *decode.Error
+	if colored {
+		buffers.colors = grow(buffers.colors, int(clen))
+		colors = buffers.colors[:clen]
+		_, written, err := lzstd.DecodeInto(colors, raw[min(coff, int64(len(raw))):], reader.voc)
+		if err != nil {
+			broken = reader.decodeError(ref.sprite, ref.frame, ref.offset+coff, "decoding colours", err)
+			var lz *decode.Error
+			if errors.As(err, &lz) {
+				broken.Offset += lz.Offset
+				broken.Reason += ": " + lz.Reason
+				broken.Err = lz.Err
+			}
+			colors = colors[:written]
+		}
+	}
+
+	lines, w, bounds := int(h.Lines), int(h.Lx), image.Rect(0, 0, int(h.Lx), int(h.Ly))
+	switch {
+	case colored:
+		var mask *nationalMask
+		if frame.Type() == NationalMaskFrame && reader.options.nationCount > 0 {
+			frame.Mask = image.NewAlpha(bounds)
+			mask = &nationalMask{Alpha: frame.Mask, first: reader.options.nationFirst, count: reader.options.nationCount}
+		}
+		if reader.options.paletted {
+			frame.Image = renderIndexed(shape, colors, lines, w, bounds, reader.palettes[frame.Type().Opacity()], frame.transparent, mask)
+			break
+		}
+		img := renderStd(shape, colors, lines, w, bounds, &reader.rgba, mask)
+		frame.Image = img
+		if a := frame.Type().Opacity(); a != 0xFF {
+			frame.Image = withOpacity(img, a)
+		}
+	case frame.Type() == ShadowFrame:
+		frame.Mask = image.NewAlpha(bounds)
+		frame.Image = renderShadow(shape, lines, w, bounds, reader.options.shadowColor, frame.Mask)
+	}
+	if broken != nil {
+		return frame, broken
+	}
+	return frame, nil
+}
+
+// bytesAt returns up to n bytes of the file from offset on, sliced from the
+// file data when it is in memory and read into buf otherwise.
+func (reader *Reader) bytesAt(offset, n int64, buf *[]byte) []byte {
+	if offset < 0 || offset >= reader.size {
+		return nil
+	}
+	n = min(n, reader.size-offset)
+	if reader.data != nil {
+		return reader.data[offset : offset+n]
+	}
+	*buf = grow(*buf, int(n))
+	got, _ := reader.r.ReadAt((*buf)[:n], offset)
+	return (*buf)[:got]
+}
+
+func grow(buf []byte, n int) []byte {
+	if cap(buf) < n {
+		return make([]byte, n)
+	}
+	return buf[:n]
+}
+
+// frameCache is a least recently used set of decoded frames keyed by their
+// offset. A nil cache stores nothing.
+type frameCache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	items map[int64]*list.Element
+}
+
+type cacheItem struct {
+	offset int64
+	frame  *Frame
+}
+
+func newFrameCache(size int) *frameCache {
+	return &frameCache{
+		size:  size,
+		order: list.New(),
+		items: make(map[int64]*list.Element),
+	}
+}
+
+func (cache *frameCache) get(offset int64) (*Frame, bool) {
+	if cache == nil {
+		return nil, false
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	el, ok := cache.items[offset]
+	if !ok {
+		return nil, false
+	}
+	cache.order.MoveToFront(el)
+	return el.Value.(*cacheItem).frame, true
+}
+
+func (cache *frameCache) put(offset int64, frame *Frame) {
+	if cache == nil {
+		return
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if el, ok := cache.items[offset]; ok {
+		el.Value.(*cacheItem).frame = frame
+		cache.order.MoveToFront(el)
+		return
+	}
+	cache.items[offset] = cache.order.PushFront(&cacheItem{offset: offset, frame: frame})
+	if cache.order.Len() > cache.size {
+		last := cache.order.Back()
+		cache.order.Remove(last)
+		delete(cache.items, last.Value.(*cacheItem).offset)
+	}
+}
@@ -0,0 +1,256 @@
+package gp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"sync/atomic"
+	"testing"
+)
+
+// countingReaderAt counts the bytes read through it.
+type countingReaderAt struct {
+	r *bytes.Reader
+	n atomic.Int64
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(p, off)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// readerSprites returns three sprites of two frames each.
+func readerSprites() []Sprite {
+	palette := testPalette()
+	var sprites []Sprite
+	for i := 0; i < 3; i++ {
+		sprites = append(sprites, Sprite{Frames: []*Frame{
+			NewFrame(testImage(palette), image.Pt(i, 0)),
+			NewTypedFrame(Transparent50Frame, testImage(palette), image.Pt(0, i)),
+		}})
+	}
+	return sprites
+}
+
+func pix(frame *Frame) *byte {
+	return &frame.Image.(*image.RGBA).Pix[0]
+}
+
+func TestReaderLazy(t *testing.T) {
+	data := encode(t, readerSprites()...)
+	r := &countingReaderAt{r: bytes.NewReader(data)}
+	reader, err := Open(r, int64(len(data)), testPalette())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the headers, picture table and vocabulary are read.
+	indexed := r.n.Load()
+	if max := binary.Size(header{}) + 4*3 + int(reader.header.VocLength) + 6*frameHeaderSize; indexed > int64(max) {
+		t.Fatalf("Open read %d bytes, want at most %d", indexed, max)
+	}
+	if reader.Len() != 3 || reader.Frames(1) != 2 || reader.Frames(3) != 0 {
+		t.Fatalf("Len = %d, Frames(1) = %d", reader.Len(), reader.Frames(1))
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(data), testPalette())
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, err := reader.Frame(2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := decoder.Sprites[2].Frames[1]
+	if frame.Rect() != want.Rect() || !bytes.Equal(frame.Image.(*image.NRGBA).Pix, want.Image.(*image.NRGBA).Pix) {
+		t.Fatal("frame differs from the eagerly decoded one")
+	}
+	if r.n.Load() == indexed {
+		t.Fatal("Frame read nothing")
+	}
+
+	sprite, err := reader.Sprite(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sprite.Frames) != 2 || sprite.Rect() != decoder.Sprites[1].Rect() {
+		t.Fatalf("Sprite(1) has %d frames in %v", len(sprite.Frames), sprite.Rect())
+	}
+
+	for _, ij := range [][2]int{{-1, 0}, {3, 0}, {0, 2}, {0, -1}} {
+		if _, err := reader.Frame(ij[0], ij[1]); err != ErrOutOfRange {
+			t.Errorf("Frame(%d, %d): err = %v, want %v", ij[0], ij[1], err, ErrOutOfRange)
+		}
+	}
+	if _, err := reader.Sprite(3); err != ErrOutOfRange {
+		t.Errorf("Sprite(3): err = %v, want %v", err, ErrOutOfRange)
+	}
+}
+
+func TestReaderCache(t *testing.T) {
+	data := encode(t, readerSprites()...)
+	r := &countingReaderAt{r: bytes.NewReader(data)}
+	reader, err := Open(r, int64(len(data)), testPalette(), WithCache(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := reader.Frame(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A hit reads nothing and shares the pixels, not the Frame.
+	read := r.n.Load()
+	hit, err := reader.Frame(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.n.Load() != read || pix(hit) != pix(first) {
+		t.Fatal("second Frame call missed the cache")
+	}
+	if hit == first {
+		t.Fatal("cache handed out the same Frame twice")
+	}
+	hit.Image = nil
+	if again, _ := reader.Frame(0, 0); again.Image == nil {
+		t.Fatal("changing a returned Frame changed the cached one")
+	}
+
+	// Two more frames evict the least recently used one.
+	if _, err := reader.Frame(1, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reader.Frame(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reader.Frame(2, 0); err != nil {
+		t.Fatal(err)
+	}
+	read = r.n.Load()
+	if frame, _ := reader.Frame(0, 0); pix(frame) != pix(first) || r.n.Load() != read {
+		t.Fatal("recently used frame was evicted")
+	}
+	if _, err := reader.Frame(1, 0); err != nil {
+		t.Fatal(err)
+	}
+	if r.n.Load() == read {
+		t.Fatal("least recently used frame was not evicted")
+	}
+
+	// Without a cache every call decodes.
+	reader, err = Open(bytes.NewReader(data), int64(len(data)), testPalette())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := reader.Frame(0, 0)
+	b, _ := reader.Frame(0, 0)
+	if pix(a) == pix(b) {
+		t.Fatal("frames shared without a cache")
+	}
+}
+
+func TestReaderLoop(t *testing.T) {
+	data := encode(t, readerSprites()...)
+	reader, err := Open(bytes.NewReader(data), int64(len(data)), testPalette())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Point the second frame of sprite 0 back at the first.
+	first, second := reader.sprites[0][0].offset, reader.sprites[0][1].offset
+	binary.LittleEndian.PutUint32(data[second:], uint32(int32(first-second)))
+
+	reader, err = Open(bytes.NewReader(data), int64(len(data)), testPalette())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reader.Frames(0) != 2 || reader.Frames(1) != 2 {
+		t.Fatalf("Frames = %d, %d, want 2, 2", reader.Frames(0), reader.Frames(1))
+	}
+	if problems := reader.Problems(); len(problems) != 1 || problems[0].Sprite != 0 || problems[0].Offset != first {
+		t.Fatalf("problems = %v", problems)
+	}
+	if _, err := Open(bytes.NewReader(data), int64(len(data)), testPalette(), WithStrict()); err == nil {
+		t.Fatal("strict: looping chain accepted")
+	}
+}
+
+func TestReaderBudget(t *testing.T) {
+	data := encode(t, readerSprites()...)
+	reader, err := Open(bytes.NewReader(data), int64(len(data)), testPalette())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Widen the first frame to most of the area the file allows and point
+	// every sprite at it.
+	first := reader.sprites[0][0].offset
+	lx := int(maxPixelsPerByte*int64(len(data))*3/5) / int(reader.sprites[0][0].header.Ly)
+	binary.LittleEndian.PutUint16(data[first+8:], uint16(lx))
+	pictures := binary.Size(header{})
+	for i := 0; i < 3; i++ {
+		binary.LittleEndian.PutUint32(data[pictures+4*i:], uint32(first))
+	}
+
+	reader, err = Open(bytes.NewReader(data), int64(len(data)), testPalette())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reader.Frames(0) != 2 || reader.Frames(1) != 0 || reader.Frames(2) != 0 {
+		t.Fatalf("Frames = %d, %d, %d, want 2, 0, 0", reader.Frames(0), reader.Frames(1), reader.Frames(2))
+	}
+	if problems := reader.Problems(); len(problems) != 2 || problems[0].Sprite != 1 || problems[1].Sprite != 2 {
+		t.Fatalf("problems = %v", problems)
+	}
+	if _, err := Open(bytes.NewReader(data), int64(len(data)), testPalette(), WithStrict()); err == nil {
+		t.Fatal("strict: frames past the budget accepted")
+	}
+}
+
+// Sprites sharing one large frame header reach the absolute bound long
+// before the one set by the file size.
+func TestReaderMaxPixels(t *testing.T) {
+	const sprites = 600
+	palette := testPalette()
+	list := make([]Sprite, sprites)
+	for i := range list {
+		list[i].Frames = []*Frame{NewFrame(testImage(palette), image.Point{})}
+	}
+	data := encode(t, list...)
+	reader, err := Open(bytes.NewReader(data), int64(len(data)), palette)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, ly := reader.sprites[0][0].offset, int64(reader.sprites[0][0].header.Ly)
+	binary.LittleEndian.PutUint16(data[first+8:], 0x7FFF)
+	pictures := binary.Size(header{})
+	for i := range sprites {
+		binary.LittleEndian.PutUint32(data[pictures+4*i:], uint32(first))
+	}
+	// Trailing bytes lift the bound set by the file size above the area of
+	// all the sprites.
+	area := 0x7FFF * ly
+	data = append(data, make([]byte, sprites*area/maxPixelsPerByte)...)
+
+	for _, tc := range []struct {
+		opts []Option
+		want int64
+	}{
+		{nil, defaultMaxPixels / area},
+		{[]Option{WithMaxPixels(10 * area)}, 10},
+		{[]Option{WithMaxPixels(0)}, sprites},
+	} {
+		reader, err := Open(bytes.NewReader(data), int64(len(data)), palette, tc.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		indexed := int64(0)
+		for i := range sprites {
+			indexed += int64(reader.Frames(i))
+		}
+		if indexed != tc.want || int64(len(reader.Problems())) != sprites-tc.want {
+			t.Errorf("%d options: %d frames indexed with %d problems, want %d", len(tc.opts), indexed, len(reader.Problems()), tc.want)
+		}
+	}
+	if _, err := Open(bytes.NewReader(data), int64(len(data)), palette, WithStrict()); err == nil {
+		t.Fatal("strict: frames past the bound accepted")
+	}
+}
@@ -3,24 +3,114 @@ package gp
 import (
 	"image"
 	"image/color"
-	"io"
-
-	"gitgub.com/cam-per/gossacks/utils"
 )
 
-func (frame *Frame) renderStd(shaper, painter io.Reader, palette color.Palette) error {
-	canvas := image.NewRGBA(image.Rect(0, 0, int(frame.header.Lx), int(frame.header.Ly)))
-	frame.Image = canvas
+// maxLineSize is the longest a shape line can be: a count byte and 127
+// space/pixels pairs.
+const maxLineSize = 1 + 2*maxLongPairs
 
-	w := canvas.Bounds().Dx()
+// maxPixelsPerByte bounds the total area of the frames of a file by its size.
+// Empty lines take one byte whatever their width, so the bound is loose: a
+// few megabytes of forged headers still reach gigabytes of pixels, which
+// defaultMaxPixels, settable with WithMaxPixels, caps whatever the size.
+const maxPixelsPerByte = 256
 
-	for Y := 0; Y < int(frame.header.Lines); Y++ {
-		currentX := 0
+// defaultMaxPixels bounds the total area of the frames of a file, 512 MiB
+// once decoded to RGBA.
+const defaultMaxPixels = 1 << 27
+
+// renderStd draws the frame lines, taking one colour index from colors per
+// pixel and writing its premultiplied RGBA value from rgba. When mask is not
+// nil the pixels drawn with a national colour are also marked in it.
+func renderStd(shape, colors []byte, lines, w int, bounds image.Rectangle, rgba *[256][4]byte, mask *nationalMask) *image.RGBA {
+	canvas := image.NewRGBA(bounds)
+	walkLines(shape, lines, w, func(x, y, n int) bool {
+		n = min(n, len(colors))
+		row := canvas.Pix[y*canvas.Stride+4*x:]
+		for i, idx := range colors[:n] {
+			copy(row[4*i:4*i+4], rgba[idx][:])
+		}
+		mask.mark(x, y, colors[:n])
+		colors = colors[n:]
+		return len(colors) > 0
+	})
+	return canvas
+}
 
-		cmd, err := utils.ReadByte(shaper)
-		if err != nil {
-			return err
+// renderIndexed is like renderStd but copies the colour indices into a
+// paletted image whose undrawn pixels hold the transparent index.
+func renderIndexed(shape, colors []byte, lines, w int, bounds image.Rectangle, palette color.Palette, transparent uint8, mask *nationalMask) *image.Paletted {
+	canvas := image.NewPaletted(bounds, palette)
+	if transparent != 0 {
+		for i := range canvas.Pix {
+			canvas.Pix[i] = transparent
 		}
+	}
+	walkLines(shape, lines, w, func(x, y, n int) bool {
+		n = copy(canvas.Pix[y*canvas.Stride+x:][:n], colors)
+		mask.mark(x, y, colors[:n])
+		colors = colors[n:]
+		return len(colors) > 0
+	})
+	return canvas
+}
+
+// renderShadow fills the pixels covered by the frame lines with c and marks
+// them in mask. Shadow frames carry no colour stream.
+func renderShadow(shape []byte, lines, w int, bounds image.Rectangle, c color.Color, mask *image.Alpha) *image.NRGBA {
+	canvas := image.NewNRGBA(bounds)
+	nrgba := color.NRGBAModel.Convert(c).(color.NRGBA)
+	px := [4]byte{nrgba.R, nrgba.G, nrgba.B, nrgba.A}
+	walkLines(shape, lines, w, func(x, y, n int) bool {
+		row := canvas.Pix[y*canvas.Stride+4*x:]
+		for i := 0; i < n; i++ {
+			copy(row[4*i:4*i+4], px[:])
+		}
+		markMask(mask, x, y, n)
+		return true
+	})
+	return canvas
+}
+
+func markMask(mask *image.Alpha, x, y, n int) {
+	if mask == nil {
+		return
+	}
+	row := mask.Pix[y*mask.Stride+x:][:n]
+	for i := range row {
+		row[i] = 0xFF
+	}
+}
+
+// nationalMask is the Mask of a national mask frame, marking the pixels drawn
+// with one of count indices from first on.
+type nationalMask struct {
+	*image.Alpha
+	first, count int
+}
+
+func (mask *nationalMask) mark(x, y int, colors []byte) {
+	if mask == nil {
+		return
+	}
+	row := mask.Pix[y*mask.Stride+x:][:len(colors)]
+	for i, idx := range colors {
+		if int(idx)-mask.first >= 0 && int(idx)-mask.first < mask.count {
+			row[i] = 0xFF
+		}
+	}
+}
+
+// walkLines parses the shape of a frame and calls span for every run of n
+// pixels starting at (x, y), clipped to width w, until span returns false
+// or the shape ends.
+func walkLines(shape []byte, lines, w int, span func(x, y, n int) bool) {
+	pos := 0
+	for y := 0; y < lines && pos < len(shape); y++ {
+		currentX := 0
+
+		cmd := shape[pos]
+		pos++
 
 		switch {
 		case cmd == 0:
@@ -34,59 +124,73 @@ func (frame *Frame) renderStd(shaper, painter io.Reader, palette color.Palette)
 			if (cmd & 0x20) != 0 {
 				pixMask = 0x10
 			}
-			count := cmd & 0x1F
+			count := int(cmd & 0x1F)
 
-			for p := 0; p < int(count); p++ {
-				pack, err := utils.ReadByte(shaper)
-				if err != nil {
-					return err
+			for p := 0; p < count; p++ {
+				if pos >= len(shape) {
+					return
 				}
+				pack := shape[pos]
+				pos++
 				space := int((pack & 0x0F) | spaceMask)
 				pixels := int(((pack >> 4) & 0x0F) | pixMask)
 
 				currentX += space
-				for i := 0; i < pixels; i++ {
-					if currentX >= w {
-						break
-					}
-
-					idx, err := utils.ReadByte(painter)
-					if err != nil {
-						return err
-					}
-
-					canvas.Set(currentX, Y, palette[idx])
-					currentX++
+				n := min(pixels, max(w-currentX, 0))
+				if n > 0 && !span(currentX, y, n) {
+					return
 				}
+				currentX += n
 			}
 		default:
 			pairs := int(cmd)
 			for pi := 0; pi < pairs; pi++ {
-				space, err := utils.ReadByte(shaper)
-				if err != nil {
-					return err
-				}
-				pixels, err := utils.ReadByte(shaper)
-				if err != nil {
-					return err
+				if pos+2 > len(shape) {
+					return
 				}
+				space, pixels := int(shape[pos]), int(shape[pos+1])
+				pos += 2
 
-				currentX += int(space)
-				for i := 0; i < int(pixels); i++ {
-					if currentX >= w {
-						break
-					}
-
-					idx, err := utils.ReadByte(painter)
-					if err != nil {
-						return err
-					}
-
-					canvas.Set(currentX, Y, palette[idx])
-					currentX++
+				currentX += space
+				n := min(pixels, max(w-currentX, 0))
+				if n > 0 && !span(currentX, y, n) {
+					return
 				}
+				currentX += n
 			}
 		}
 	}
-	return nil
+}
+
+// framePalette returns the palette of a paletted frame: palette padded to
+// 256 entries, its colours given alpha a and the transparent entry cleared.
+func framePalette(palette color.Palette, transparent, a uint8) color.Palette {
+	p := make(color.Palette, 256)
+	for i := range p {
+		if i >= len(palette) {
+			p[i] = color.Transparent
+			continue
+		}
+		if a == 0xFF {
+			p[i] = palette[i]
+			continue
+		}
+		c := color.NRGBAModel.Convert(palette[i]).(color.NRGBA)
+		c.A = a
+		p[i] = c
+	}
+	p[transparent] = color.Transparent
+	return p
+}
+
+// withOpacity returns a non-premultiplied copy of the opaque img whose drawn
+// pixels have alpha a, keeping the palette colours exact.
+func withOpacity(img *image.RGBA, a uint8) *image.NRGBA {
+	out := &image.NRGBA{Pix: img.Pix, Stride: img.Stride, Rect: img.Rect}
+	for i := 3; i < len(out.Pix); i += 4 {
+		if out.Pix[i] != 0 {
+			out.Pix[i] = a
+		}
+	}
+	return out
 }
@@ -0,0 +1,72 @@
+package gp
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+// benchmarkSprites returns sprites with frames of the given size, each a
+// noisy blob with transparent gaps like a unit sprite.
+func benchmarkSprites(palette color.Palette, sprites, frames, size int) []Sprite {
+	rng := rand.New(rand.NewSource(1))
+	list := make([]Sprite, sprites)
+	for i := range list {
+		for j := 0; j < frames; j++ {
+			img := image.NewPaletted(image.Rect(0, 0, size, size), append(color.Palette{color.Transparent}, palette[1:]...))
+			c := size / 2
+			for y := 0; y < size; y++ {
+				for x := 0; x < size; x++ {
+					if (x-c)*(x-c)+(y-c)*(y-c) < c*c && rng.Intn(16) != 0 {
+						img.SetColorIndex(x, y, uint8(1+rng.Intn(32)))
+					}
+				}
+			}
+			list[i].Frames = append(list[i].Frames, NewTypedFrame(FrameType([]int{0, 1, 3}[j%3]), img, image.Pt(-c, -c)))
+		}
+	}
+	return list
+}
+
+func BenchmarkDecode(b *testing.B) {
+	palette := testPalette()
+	data := encode(b, benchmarkSprites(palette, 8, 12, 64)...)
+
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"rgba", nil},
+		{"paletted", []Option{WithPaletted(0)}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.SetBytes(8 * 12 * 64 * 64)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := NewDecoder(bytes.NewReader(data), palette, bc.opts...); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkReaderFrame(b *testing.B) {
+	palette := testPalette()
+	data := encode(b, benchmarkSprites(palette, 4, 12, 128)...)
+	reader, err := Open(bytes.NewReader(data), int64(len(data)), palette)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(128 * 128)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := reader.Frame(i%4, i%12); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Package decode holds the error type shared by the decoders of gsc and its
+// format packages, which gsc re-exports as DecodeError.
+package decode
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Error describes a problem found while decoding an archive or an asset,
+// locating it as precisely as the decoder could. Sprite, Frame and Offset
+// are -1 when they do not apply or are unknown.
+type Error struct {
+	Format string
+	Path   string
+	Sprite int
+	Frame  int
+	Offset int64
+	Reason string
+	Err    error
+}
+
+// NewError returns an Error for format with no location.
+func NewError(format, reason string, err error) *Error {
+	return &Error{Format: format, Sprite: -1, Frame: -1, Offset: -1, Reason: reason, Err: err}
+}
+
+// At returns a copy of e located at offset.
+func (e *Error) At(offset int64) *Error {
+	c := *e
+	c.Offset = offset
+	return &c
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Format)
+	if e.Path != "" {
+		fmt.Fprintf(&b, ": %s", e.Path)
+	}
+	if e.Sprite >= 0 {
+		fmt.Fprintf(&b, ": sprite %d", e.Sprite)
+	}
+	if e.Frame >= 0 {
+		fmt.Fprintf(&b, " frame %d", e.Frame)
+	}
+	if e.Offset >= 0 {
+		fmt.Fprintf(&b, ": offset %#x", e.Offset)
+	}
+	if e.Reason != "" {
+		fmt.Fprintf(&b, ": %s", e.Reason)
+	}
+	if e.Err != nil {
+		fmt.Fprintf(&b, ": %v", e.Err)
+	}
+	return b.String()
+}
+
+func (e *Error) Unwrap() error { return e.Err }
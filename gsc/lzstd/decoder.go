@@ -2,105 +2,173 @@ package lzstd
 
 import (
 	"bufio"
-	"bytes"
 	"errors"
+	"fmt"
 	"io"
 
-	"gitgub.com/cam-per/gossacks/utils"
+	"gitgub.com/cam-per/gossacks/gsc/internal/decode"
 )
 
 var (
 	ErrVocOutOfRange = errors.New("voc: out of range")
 )
 
+// Decoder streams the bytes of a compressed stream. The last vocabulary
+// reference may run past the unpacked length; its bytes are still returned.
 type Decoder struct {
-	r         *bufio.Reader
+	r         io.ByteReader
+	br        *bufio.Reader
 	voc       []byte
-	out       bytes.Buffer
+	pending   []byte
 	flag      byte
 	bitsLeft  int
 	remaining int64
+	in        int64
 }
 
 func NewDecoder(r io.Reader, voc []byte, unpackLength int64) *Decoder {
-	decoder := &Decoder{
-		r:         bufio.NewReader(r),
-		voc:       voc,
-		remaining: unpackLength,
-		bitsLeft:  0,
-	}
-	decoder.out.Grow(len(voc))
+	decoder := &Decoder{}
+	decoder.Reset(r, voc, unpackLength)
 	return decoder
 }
 
-func (decoder *Decoder) Read(p []byte) (n int, err error) {
-
-	for decoder.remaining > 0 || decoder.out.Len() > 0 {
-		nn, err := decoder.flushBuffer(p[n:])
-		if err != nil {
-			return n, err
-		}
-		n += nn
-		if n == len(p) {
-			return n, nil
+// Reset makes the decoder read a new stream, reusing its buffer. Readers
+// that implement io.ByteReader are read directly.
+func (decoder *Decoder) Reset(r io.Reader, voc []byte, unpackLength int64) {
+	if br, ok := r.(io.ByteReader); ok {
+		decoder.r = br
+	} else {
+		if decoder.br == nil {
+			decoder.br = bufio.NewReader(r)
+		} else {
+			decoder.br.Reset(r)
 		}
+		decoder.r = decoder.br
+	}
+	decoder.voc = voc
+	decoder.pending = nil
+	decoder.flag = 0
+	decoder.bitsLeft = 0
+	decoder.remaining = unpackLength
+	decoder.in = 0
+}
 
-		if decoder.remaining <= 0 {
-			continue
-		}
+func (decoder *Decoder) Read(p []byte) (n int, err error) {
+	n = copy(p, decoder.pending)
+	decoder.pending = decoder.pending[n:]
 
+	for n < len(p) && decoder.remaining > 0 {
 		if decoder.bitsLeft == 0 {
-			decoder.flag, err = utils.ReadByte(decoder.r)
-			if err != nil {
-				if err == io.EOF {
-					err = io.ErrUnexpectedEOF
-				}
+			if decoder.flag, err = decoder.readByte(); err != nil {
 				return n, err
 			}
 			decoder.bitsLeft = 8
 		}
 
 		if (decoder.flag & 0x80) != 0 {
-			word, err := utils.ReadUint16LE(decoder.r)
+			lo, err := decoder.readByte()
 			if err != nil {
-				if err == io.EOF {
-					err = io.ErrUnexpectedEOF
-				}
 				return n, err
 			}
-
+			hi, err := decoder.readByte()
+			if err != nil {
+				return n, err
+			}
+			word := uint16(lo) | uint16(hi)<<8
 			count := int((word >> 12) + 3)
 			offset := int(word & 0x0FFF)
 
 			if offset+count > len(decoder.voc) {
-				return n, ErrVocOutOfRange
+				return n, vocError(decoder.in-2, offset, count)
 			}
-			decoder.out.Write(decoder.voc[offset : offset+count])
+			ref := decoder.voc[offset : offset+count]
+			c := copy(p[n:], ref)
+			decoder.pending = ref[c:]
+			n += c
 			decoder.remaining -= int64(count)
 		} else {
-			d, err := utils.ReadByte(decoder.r)
+			d, err := decoder.readByte()
 			if err != nil {
-				if err == io.EOF {
-					err = io.ErrUnexpectedEOF
-				}
 				return n, err
 			}
-			decoder.out.WriteByte(d)
+			p[n] = d
+			n++
 			decoder.remaining--
 		}
 
 		decoder.flag <<= 1
 		decoder.bitsLeft--
 	}
-	if decoder.remaining == 0 && decoder.out.Len() == 0 {
+	if n == 0 && len(p) > 0 && decoder.remaining <= 0 {
 		return 0, io.EOF
 	}
-	return
+	return n, nil
+}
+
+func (decoder *Decoder) readByte() (byte, error) {
+	b, err := decoder.r.ReadByte()
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return b, truncated(decoder.in, err)
+	}
+	decoder.in++
+	return b, nil
+}
+
+// truncated reports the stream ending, or failing to read, at offset.
+func truncated(offset int64, err error) error {
+	return decode.NewError("lzstd", "stream cut short", err).At(offset)
+}
+
+// vocError reports the reference at offset pointing past the vocabulary.
+func vocError(offset int64, at, count int) error {
+	reason := fmt.Sprintf("reference to %d bytes at %#x", count, at)
+	return decode.NewError("lzstd", reason, ErrVocOutOfRange).At(offset)
 }
 
-func (decoder *Decoder) flushBuffer(buf []byte) (n int, err error) {
-	if decoder.out.Len() == 0 {
-		return 0, nil
+// DecodeInto fills dst with the stream compressed in src. A vocabulary
+// reference running past the end of dst is cut short. It returns the number
+// of bytes of src used and of dst filled, which is less than len(dst) only
+// on error. Errors are *decode.Error values whose Offset is relative to
+// src.
+func DecodeInto(dst, src, voc []byte) (read, written int, err error) {
+	var flag byte
+	bitsLeft, in, out := 0, 0, 0
+	for out < len(dst) {
+		if bitsLeft == 0 {
+			if in >= len(src) {
+				return in, out, truncated(int64(in), io.ErrUnexpectedEOF)
+			}
+			flag, bitsLeft = src[in], 8
+			in++
+		}
+
+		if (flag & 0x80) != 0 {
+			if in+2 > len(src) {
+				return in, out, truncated(int64(in), io.ErrUnexpectedEOF)
+			}
+			word := uint16(src[in]) | uint16(src[in+1])<<8
+			in += 2
+			count := int((word >> 12) + 3)
+			offset := int(word & 0x0FFF)
+
+			if offset+count > len(voc) {
+				return in, out, vocError(int64(in-2), offset, count)
+			}
+			out += copy(dst[out:], voc[offset:offset+count])
+		} else {
+			if in >= len(src) {
+				return in, out, truncated(int64(in), io.ErrUnexpectedEOF)
+			}
+			dst[out] = src[in]
+			in++
+			out++
+		}
+
+		flag <<= 1
+		bitsLeft--
 	}
-	return decoder.out.Read(buf)
+	return in, out, nil
 }
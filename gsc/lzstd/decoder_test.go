@@ -0,0 +1,202 @@
+package lzstd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+
+	"gitgub.com/cam-per/gossacks/utils"
+)
+
+// legacyDecoder is the byte-at-a-time decoder Decoder replaced, kept to
+// check the output and measure the speedup against.
+type legacyDecoder struct {
+	r         *bufio.Reader
+	voc       []byte
+	out       bytes.Buffer
+	flag      byte
+	bitsLeft  int
+	remaining int64
+}
+
+func newLegacyDecoder(r io.Reader, voc []byte, unpackLength int64) *legacyDecoder {
+	decoder := &legacyDecoder{
+		r:         bufio.NewReader(r),
+		voc:       voc,
+		remaining: unpackLength,
+	}
+	decoder.out.Grow(len(voc))
+	return decoder
+}
+
+func (decoder *legacyDecoder) Read(p []byte) (n int, err error) {
+	for decoder.remaining > 0 || decoder.out.Len() > 0 {
+		if decoder.out.Len() > 0 {
+			nn, _ := decoder.out.Read(p[n:])
+			n += nn
+		}
+		if n == len(p) {
+			return n, nil
+		}
+		if decoder.remaining <= 0 {
+			continue
+		}
+
+		if decoder.bitsLeft == 0 {
+			decoder.flag, err = utils.ReadByte(decoder.r)
+			if err != nil {
+				return n, io.ErrUnexpectedEOF
+			}
+			decoder.bitsLeft = 8
+		}
+
+		if (decoder.flag & 0x80) != 0 {
+			word, err := utils.ReadUint16LE(decoder.r)
+			if err != nil {
+				return n, io.ErrUnexpectedEOF
+			}
+			count := int((word >> 12) + 3)
+			offset := int(word & 0x0FFF)
+			if offset+count > len(decoder.voc) {
+				return n, ErrVocOutOfRange
+			}
+			decoder.out.Write(decoder.voc[offset : offset+count])
+			decoder.remaining -= int64(count)
+		} else {
+			d, err := utils.ReadByte(decoder.r)
+			if err != nil {
+				return n, io.ErrUnexpectedEOF
+			}
+			decoder.out.WriteByte(d)
+			decoder.remaining--
+		}
+
+		decoder.flag <<= 1
+		decoder.bitsLeft--
+	}
+	if decoder.remaining <= 0 && decoder.out.Len() == 0 {
+		return n, io.EOF
+	}
+	return
+}
+
+// testStream compresses size bytes of sprite-like data: short runs of
+// a few colours drawn from a small set, so the vocabulary gets used.
+func testStream(size int) (plain, packed, voc []byte) {
+	rng := rand.New(rand.NewSource(1))
+	plain = make([]byte, 0, size)
+	for len(plain) < size {
+		c := byte(rng.Intn(24))
+		for n := 1 + rng.Intn(6); n > 0 && len(plain) < size; n-- {
+			plain = append(plain, c+byte(rng.Intn(2)))
+		}
+	}
+	voc = BuildVocabulary([][]byte{plain}, MaxVocabulary)
+	return plain, NewEncoder(voc).Encode(nil, plain), voc
+}
+
+func TestDecoderMatchesLegacy(t *testing.T) {
+	plain, packed, voc := testStream(1 << 16)
+
+	legacy, err := io.ReadAll(newLegacyDecoder(bytes.NewReader(packed), voc, int64(len(plain))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(NewDecoder(bytes.NewReader(packed), voc, int64(len(plain))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, legacy) {
+		t.Fatal("Decoder output differs from the legacy decoder")
+	}
+	if !bytes.Equal(got[:len(plain)], plain) {
+		t.Fatal("Decoder output differs from the input")
+	}
+
+	dst := make([]byte, len(plain))
+	n, written, err := DecodeInto(dst, packed, voc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(packed) || written != len(dst) || !bytes.Equal(dst, plain) {
+		t.Fatalf("DecodeInto used %d of %d bytes", n, len(packed))
+	}
+
+	clear(dst)
+	_, written, err = DecodeInto(dst, packed[:len(packed)/2], voc)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("truncated input: err = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if written == 0 || written >= len(dst) || !bytes.Equal(dst[:written], plain[:written]) {
+		t.Fatalf("truncated input: wrote %d of %d bytes", written, len(dst))
+	}
+}
+
+func BenchmarkDecoder(b *testing.B) {
+	plain, packed, voc := testStream(1 << 16)
+	buf := make([]byte, 4096)
+
+	b.Run("legacy", func(b *testing.B) {
+		b.SetBytes(int64(len(plain)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			decoder := newLegacyDecoder(bytes.NewReader(packed), voc, int64(len(plain)))
+			for {
+				if _, err := decoder.Read(buf); err != nil {
+					break
+				}
+			}
+		}
+	})
+
+	b.Run("stream", func(b *testing.B) {
+		b.SetBytes(int64(len(plain)))
+		b.ReportAllocs()
+		r := bytes.NewReader(packed)
+		decoder := NewDecoder(r, voc, 0)
+		for i := 0; i < b.N; i++ {
+			r.Reset(packed)
+			decoder.Reset(r, voc, int64(len(plain)))
+			for {
+				if _, err := decoder.Read(buf); err != nil {
+					break
+				}
+			}
+		}
+	})
+
+	b.Run("into", func(b *testing.B) {
+		b.SetBytes(int64(len(plain)))
+		b.ReportAllocs()
+		dst := make([]byte, len(plain))
+		for i := 0; i < b.N; i++ {
+			if _, _, err := DecodeInto(dst, packed, voc); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func FuzzDecoder(f *testing.F) {
+	plain, packed, voc := testStream(1 << 10)
+	f.Add(packed, voc, uint16(len(plain)))
+	f.Add(packed[:100], voc[:10], uint16(len(plain)))
+
+	f.Fuzz(func(t *testing.T, packed, voc []byte, size uint16) {
+		got, streamErr := io.ReadAll(NewDecoder(bytes.NewReader(packed), voc, int64(size)))
+		dst := make([]byte, size)
+		n, written, err := DecodeInto(dst, packed, voc)
+		if n > len(packed) || written > len(dst) || (err == nil && written != len(dst)) {
+			t.Fatalf("DecodeInto used %d of %d bytes and wrote %d of %d", n, len(packed), written, len(dst))
+		}
+		if (err == nil) != (streamErr == nil) {
+			t.Fatalf("DecodeInto err = %v, Decoder err = %v", err, streamErr)
+		}
+		if err == nil && !bytes.Equal(got[:size], dst) {
+			t.Fatal("DecodeInto output differs from Decoder")
+		}
+	})
+}
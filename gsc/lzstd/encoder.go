@@ -0,0 +1,165 @@
+package lzstd
+
+const (
+	MaxVocabulary = 4096
+
+	minMatch  = 3
+	maxMatch  = 0x0F + minMatch
+	maxOffset = 0x0FFF
+)
+
+// Encoder produces the stream read by Decoder: groups of up to eight tokens
+// preceded by a flag byte whose bits, most significant first, mark 16-bit
+// (count<<12)|offset vocabulary references among literal bytes.
+type Encoder struct {
+	voc   []byte
+	index map[uint32][]int
+}
+
+func NewEncoder(voc []byte) *Encoder {
+	encoder := &Encoder{
+		voc:   voc,
+		index: make(map[uint32][]int),
+	}
+	for off := 0; off <= maxOffset && off+minMatch <= len(voc); off++ {
+		k := key3(voc[off:])
+		encoder.index[k] = append(encoder.index[k], off)
+	}
+	return encoder
+}
+
+// Encode appends the compressed form of src to dst. Tokens are chosen to
+// minimise the encoded size in bits.
+func (encoder *Encoder) Encode(dst, src []byte) []byte {
+	n := len(src)
+	length := make([]uint8, n)
+	offset := make([]uint16, n)
+	for i := 0; i+minMatch <= n; i++ {
+		l, off := encoder.match(src[i:])
+		length[i], offset[i] = uint8(l), uint16(off)
+	}
+
+	// cost[i] is the smallest size in bits of src[i:]; take[i] the token
+	// length chosen at i, 1 for a literal.
+	cost := make([]int, n+1)
+	take := make([]uint8, n)
+	for i := n - 1; i >= 0; i-- {
+		cost[i], take[i] = cost[i+1]+9, 1
+		for l := minMatch; l <= int(length[i]); l++ {
+			if c := cost[i+l] + 17; c < cost[i] {
+				cost[i], take[i] = c, uint8(l)
+			}
+		}
+	}
+
+	flagAt, bits := 0, 0
+	for i := 0; i < n; {
+		if bits == 0 {
+			flagAt = len(dst)
+			dst = append(dst, 0)
+			bits = 8
+		}
+		bits--
+		if l := int(take[i]); l > 1 {
+			dst[flagAt] |= 1 << bits
+			word := uint16(l-minMatch)<<12 | offset[i]
+			dst = append(dst, byte(word), byte(word>>8))
+			i += l
+		} else {
+			dst = append(dst, src[i])
+			i++
+		}
+	}
+	return dst
+}
+
+func (encoder *Encoder) match(src []byte) (int, int) {
+	best, bestOff := 0, 0
+	for _, off := range encoder.index[key3(src)] {
+		l := minMatch
+		for l < maxMatch && l < len(src) && off+l < len(encoder.voc) && encoder.voc[off+l] == src[l] {
+			l++
+		}
+		if l > best {
+			best, bestOff = l, off
+			if l == maxMatch {
+				break
+			}
+		}
+	}
+	return best, bestOff
+}
+
+func key3(p []byte) uint32 {
+	return uint32(p[0]) | uint32(p[1])<<8 | uint32(p[2])<<16
+}
+
+const (
+	dmerLength    = 4
+	segmentLength = maxMatch
+)
+
+// BuildVocabulary picks a vocabulary of at most size bytes for the given
+// samples. The samples are split into one epoch per vocabulary segment and
+// from each epoch the segment covering the most frequent, not yet covered
+// 4-byte substrings is kept.
+func BuildVocabulary(samples [][]byte, size int) []byte {
+	if size <= 0 || size > MaxVocabulary {
+		size = MaxVocabulary
+	}
+
+	var data []byte
+	for _, sample := range samples {
+		data = append(data, sample...)
+	}
+	if len(data) < segmentLength {
+		return append([]byte(nil), data[:min(len(data), size)]...)
+	}
+
+	freq := make(map[uint32]int)
+	for i := 0; i+dmerLength <= len(data); i++ {
+		freq[dmer(data[i:])]++
+	}
+
+	segments := size / segmentLength
+	epoch := max(len(data)/max(segments, 1), segmentLength)
+	voc := make([]byte, 0, size)
+	seen := make(map[uint32]struct{}, segmentLength)
+
+	score := func(seg []byte) int {
+		clear(seen)
+		total := 0
+		for j := 0; j+dmerLength <= len(seg); j++ {
+			d := dmer(seg[j:])
+			if _, ok := seen[d]; ok {
+				continue
+			}
+			seen[d] = struct{}{}
+			total += freq[d]
+		}
+		return total
+	}
+
+	for start := 0; start+segmentLength <= len(data) && len(voc)+segmentLength <= size; start += epoch {
+		end := min(start+epoch, len(data))
+		best, bestAt := 0, -1
+		for i := start; i+segmentLength <= end; i++ {
+			if s := score(data[i : i+segmentLength]); s > best {
+				best, bestAt = s, i
+			}
+		}
+		if bestAt < 0 || best < 2 {
+			continue
+		}
+		seg := data[bestAt : bestAt+segmentLength]
+		for j := 0; j+dmerLength <= len(seg); j++ {
+			freq[dmer(seg[j:])] = 0
+		}
+		voc = append(voc, seg...)
+	}
+	return voc
+}
+
+func dmer(p []byte) uint32 {
+	return uint32(p[0]) | uint32(p[1])<<8 | uint32(p[2])<<16 | uint32(p[3])<<24
+}
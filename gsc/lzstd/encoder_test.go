@@ -0,0 +1,86 @@
+package lzstd
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestEncoderRoundTrip(t *testing.T) {
+	repetitive := bytes.Repeat([]byte{7, 7, 7, 7, 1, 2, 3}, 2000)
+	stream, _, _ := testStream(1 << 14)
+
+	for _, tc := range []struct {
+		name  string
+		plain []byte
+		voc   []byte
+	}{
+		{"empty", nil, nil},
+		{"empty with vocabulary", nil, BuildVocabulary([][]byte{repetitive}, MaxVocabulary)},
+		{"short", []byte{1, 2}, nil},
+		{"no vocabulary", stream, nil},
+		{"vocabulary", stream, BuildVocabulary([][]byte{stream}, MaxVocabulary)},
+		{"small vocabulary", stream, BuildVocabulary([][]byte{stream}, 64)},
+		{"repetitive", repetitive, BuildVocabulary([][]byte{repetitive}, MaxVocabulary)},
+		{"repetitive without vocabulary", repetitive, nil},
+		{"foreign vocabulary", repetitive, BuildVocabulary([][]byte{stream}, MaxVocabulary)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			packed := NewEncoder(tc.voc).Encode(nil, tc.plain)
+
+			// Every group of up to eight literals costs a flag byte.
+			if tc.voc == nil {
+				if want := len(tc.plain) + (len(tc.plain)+7)/8; len(packed) != want {
+					t.Fatalf("packed %d bytes into %d, want %d", len(tc.plain), len(packed), want)
+				}
+			}
+
+			dst := make([]byte, len(tc.plain))
+			n, _, err := DecodeInto(dst, packed, tc.voc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != len(packed) || !bytes.Equal(dst, tc.plain) {
+				t.Fatalf("DecodeInto used %d of %d bytes", n, len(packed))
+			}
+
+			got, err := io.ReadAll(NewDecoder(bytes.NewReader(packed), tc.voc, int64(len(tc.plain))))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) < len(tc.plain) || !bytes.Equal(got[:len(tc.plain)], tc.plain) {
+				t.Fatal("Decoder output differs from the input")
+			}
+		})
+	}
+}
+
+func TestEncoderCompresses(t *testing.T) {
+	plain := bytes.Repeat([]byte{7, 7, 7, 7, 1, 2, 3}, 2000)
+	voc := BuildVocabulary([][]byte{plain}, MaxVocabulary)
+	if len(voc) == 0 || len(voc) > MaxVocabulary {
+		t.Fatalf("vocabulary has %d bytes", len(voc))
+	}
+	// Mostly long vocabulary references, each two bytes and a flag bit.
+	packed := NewEncoder(voc).Encode(nil, plain)
+	if max := len(plain) / 4; len(packed) > max {
+		t.Fatalf("packed %d bytes into %d, want at most %d", len(plain), len(packed), max)
+	}
+}
+
+func TestBuildVocabularySize(t *testing.T) {
+	plain, _, _ := testStream(1 << 14)
+	for _, size := range []int{1, segmentLength, 100, MaxVocabulary, 0, -1, MaxVocabulary + 1} {
+		voc := BuildVocabulary([][]byte{plain[:1<<13], plain[1<<13:]}, size)
+		if limit := size; limit <= 0 || limit > MaxVocabulary {
+			if len(voc) > MaxVocabulary {
+				t.Errorf("size %d: vocabulary has %d bytes", size, len(voc))
+			}
+		} else if len(voc) > limit {
+			t.Errorf("size %d: vocabulary has %d bytes", size, len(voc))
+		}
+	}
+	if voc := BuildVocabulary(nil, MaxVocabulary); len(voc) != 0 {
+		t.Errorf("no samples: vocabulary has %d bytes", len(voc))
+	}
+}
@@ -0,0 +1,290 @@
+package gsc
+
+import (
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Layer is one source of an Overlay. Layers with a higher Priority shadow
+// lower ones; among equal priorities the layer mounted last wins.
+type Layer struct {
+	Name     string
+	FS       fs.FS
+	Priority int
+}
+
+type layerFS interface {
+	stat(name string) (fs.FileInfo, error)
+	readDir(name string) ([]fs.DirEntry, error)
+	open(name string) (fs.File, error)
+}
+
+type mount struct {
+	Layer
+	fsys layerFS
+	seq  int
+}
+
+// Overlay merges several containers and directory trees into a single
+// read-only file system. Lookups are case-insensitive, like Container.Open,
+// and directory listings are merged across every layer holding that
+// directory. Mount must not be called concurrently with lookups.
+type Overlay struct {
+	mounts []*mount
+	seq    int
+}
+
+func NewOverlay(layers ...Layer) *Overlay {
+	overlay := &Overlay{}
+	for _, layer := range layers {
+		overlay.Mount(layer)
+	}
+	return overlay
+}
+
+func (overlay *Overlay) Mount(layer Layer) {
+	m := &mount{Layer: layer, seq: overlay.seq}
+	overlay.seq++
+	if container, ok := layer.FS.(*Container); ok {
+		m.fsys = containerLayer{container}
+	} else {
+		m.fsys = dirLayer{layer.FS}
+	}
+	overlay.mounts = append(overlay.mounts, m)
+	sort.SliceStable(overlay.mounts, func(i, j int) bool {
+		a, b := overlay.mounts[i], overlay.mounts[j]
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		return a.seq > b.seq
+	})
+}
+
+// Layers returns the mounted layers, highest priority first.
+func (overlay *Overlay) Layers() []Layer {
+	layers := make([]Layer, len(overlay.mounts))
+	for i, m := range overlay.mounts {
+		layers[i] = m.Layer
+	}
+	return layers
+}
+
+// Which reports the layer that serves name.
+func (overlay *Overlay) Which(name string) (Layer, error) {
+	m, _, err := overlay.lookup("which", name)
+	if err != nil {
+		return Layer{}, err
+	}
+	return m.Layer, nil
+}
+
+func (overlay *Overlay) Open(name string) (fs.File, error) {
+	m, info, err := overlay.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return m.fsys.open(name)
+	}
+	entries, err := overlay.merge(name)
+	if err != nil {
+		return nil, err
+	}
+	return &overlayDir{info: info, entries: entries}, nil
+}
+
+func (overlay *Overlay) Stat(name string) (fs.FileInfo, error) {
+	_, info, err := overlay.lookup("stat", name)
+	return info, err
+}
+
+func (overlay *Overlay) ReadDir(name string) ([]fs.DirEntry, error) {
+	_, info, err := overlay.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+	return overlay.merge(name)
+}
+
+func (overlay *Overlay) Glob(pattern string) ([]string, error) {
+	return globFold(pattern, overlay.ReadDir)
+}
+
+func (overlay *Overlay) lookup(op, name string) (*mount, fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	for _, m := range overlay.mounts {
+		info, err := m.fsys.stat(name)
+		if err != nil {
+			continue
+		}
+		if name == "." {
+			info = &namedInfo{FileInfo: info, name: "."}
+		}
+		return m, info, nil
+	}
+	return nil, nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+func (overlay *Overlay) merge(name string) ([]fs.DirEntry, error) {
+	var entries []fs.DirEntry
+	seen := make(map[string]struct{})
+	for _, m := range overlay.mounts {
+		info, err := m.fsys.stat(name)
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		list, err := m.fsys.readDir(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range list {
+			key := strings.ToLower(e.Name())
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+type namedInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (info *namedInfo) Name() string { return info.name }
+
+type overlayDir struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *overlayDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *overlayDir) Close() error               { return nil }
+
+func (d *overlayDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: errIsDir}
+}
+
+func (d *overlayDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	return readDirAt(d.entries, &d.offset, n)
+}
+
+func readDirAt(entries []fs.DirEntry, offset *int, n int) ([]fs.DirEntry, error) {
+	rest := entries[*offset:]
+	if n <= 0 {
+		*offset = len(entries)
+		return append([]fs.DirEntry(nil), rest...), nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	*offset += n
+	return append([]fs.DirEntry(nil), rest[:n]...), nil
+}
+
+type containerLayer struct {
+	container *Container
+}
+
+func (l containerLayer) find(name string) (*entry, error) {
+	e, ok := l.container.fm[strings.ToLower(name)]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return e, nil
+}
+
+func (l containerLayer) stat(name string) (fs.FileInfo, error) {
+	e, err := l.find(name)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (l containerLayer) readDir(name string) ([]fs.DirEntry, error) {
+	e, err := l.find(name)
+	if err != nil {
+		return nil, err
+	}
+	return append([]fs.DirEntry(nil), e.entries...), nil
+}
+
+func (l containerLayer) open(name string) (fs.File, error) {
+	e, err := l.find(name)
+	if err != nil {
+		return nil, err
+	}
+	return l.container.Open(e.Path())
+}
+
+type dirLayer struct {
+	fsys fs.FS
+}
+
+// resolve maps name onto the spelling used by the underlying file system,
+// matching each element case-insensitively when there is no exact match.
+func (l dirLayer) resolve(name string) (string, error) {
+	if _, err := fs.Stat(l.fsys, name); err == nil {
+		return name, nil
+	}
+	resolved := "."
+	for _, elem := range strings.Split(name, "/") {
+		entries, err := fs.ReadDir(l.fsys, resolved)
+		if err != nil {
+			return "", err
+		}
+		found := ""
+		for _, e := range entries {
+			if strings.ToLower(e.Name()) == strings.ToLower(elem) {
+				found = e.Name()
+				break
+			}
+		}
+		if found == "" {
+			return "", fs.ErrNotExist
+		}
+		resolved = path.Join(resolved, found)
+	}
+	return resolved, nil
+}
+
+func (l dirLayer) stat(name string) (fs.FileInfo, error) {
+	resolved, err := l.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.Stat(l.fsys, resolved)
+}
+
+func (l dirLayer) readDir(name string) ([]fs.DirEntry, error) {
+	resolved, err := l.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadDir(l.fsys, resolved)
+}
+
+func (l dirLayer) open(name string) (fs.File, error) {
+	resolved, err := l.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return l.fsys.Open(resolved)
+}
@@ -0,0 +1,141 @@
+package gsc_test
+
+import (
+	"io/fs"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"gitgub.com/cam-per/gossacks/gsc"
+)
+
+var modFiles = fstest.MapFS{
+	"readme.txt":          {Data: []byte("modded")},
+	"gp/units/dragun.gp":  {Data: []byte("dragoon")},
+	"gp/buildings/mil.gp": {Data: []byte("mill")},
+}
+
+func newTestOverlay(t *testing.T) (*gsc.Overlay, *gsc.Container, *gsc.Container) {
+	t.Helper()
+	base := newTestContainer(t, testFiles, &gsc.WriterOptions{Obfuscate: obfuscateUnits})
+	mod := newTestContainer(t, modFiles, nil)
+	return gsc.NewOverlay(gsc.Layer{Name: "base", FS: base}, gsc.Layer{Name: "mod", FS: mod}), base, mod
+}
+
+func TestOverlayFS(t *testing.T) {
+	overlay, _, _ := newTestOverlay(t)
+	if err := fstest.TestFS(overlay,
+		"readme.txt", "gp/units/pik.gp", "gp/units/musk.gp", "gp/units/dragun.gp",
+		"gp/buildings/mil.gp", "gp/empty.gp", "pal/agew_1.pal"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOverlayPriority(t *testing.T) {
+	overlay, _, _ := newTestOverlay(t)
+
+	data, err := fs.ReadFile(overlay, "readme.txt")
+	if err != nil || string(data) != "modded" {
+		t.Fatalf("readme.txt = %q, %v; want the later layer's copy", data, err)
+	}
+	if layer, err := overlay.Which("readme.txt"); err != nil || layer.Name != "mod" {
+		t.Fatalf("Which(readme.txt) = %q, %v", layer.Name, err)
+	}
+	if layer, err := overlay.Which("gp/units/pik.gp"); err != nil || layer.Name != "base" {
+		t.Fatalf("Which(gp/units/pik.gp) = %q, %v", layer.Name, err)
+	}
+	if _, err := overlay.Which("missing.txt"); err == nil {
+		t.Fatal("Which(missing.txt) succeeded")
+	}
+
+	// A higher priority beats mount order.
+	overlay.Mount(gsc.Layer{Name: "patch", FS: fstest.MapFS{"README.TXT": {Data: []byte("patched")}}, Priority: 1})
+	overlay.Mount(gsc.Layer{Name: "late", FS: fstest.MapFS{"readme.txt": {Data: []byte("late")}}})
+	data, err = fs.ReadFile(overlay, "readme.txt")
+	if err != nil || string(data) != "patched" {
+		t.Fatalf("readme.txt = %q, %v; want the priority layer's copy", data, err)
+	}
+	var names []string
+	for _, layer := range overlay.Layers() {
+		names = append(names, layer.Name)
+	}
+	if want := []string{"patch", "late", "mod", "base"}; !slices.Equal(names, want) {
+		t.Fatalf("Layers = %v, want %v", names, want)
+	}
+}
+
+func TestOverlayCaseInsensitive(t *testing.T) {
+	overlay, _, _ := newTestOverlay(t)
+	overlay.Mount(gsc.Layer{Name: "dir", FS: fstest.MapFS{"GP/Units/Strelok.GP": {Data: []byte("strelok")}}})
+
+	for name, want := range map[string]string{
+		"GP/UNITS/MUSK.GP":    "musketeer",
+		"gp/units/strelok.gp": "strelok",
+		"Readme.Txt":          "modded",
+	} {
+		data, err := fs.ReadFile(overlay, name)
+		if err != nil || string(data) != want {
+			t.Errorf("ReadFile(%q) = %q, %v; want %q", name, data, err, want)
+		}
+	}
+}
+
+func TestOverlayReadDir(t *testing.T) {
+	overlay, _, _ := newTestOverlay(t)
+
+	entries, err := overlay.ReadDir("gp/units")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if want := []string{"dragun.gp", "musk.gp", "pik.gp"}; !slices.Equal(names, want) {
+		t.Fatalf("ReadDir(gp/units) = %v, want %v", names, want)
+	}
+
+	entries, err = overlay.ReadDir("gp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names = names[:0]
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if want := []string{"buildings", "empty.gp", "units"}; !slices.Equal(names, want) {
+		t.Fatalf("ReadDir(gp) = %v, want %v", names, want)
+	}
+	if _, err := overlay.ReadDir("readme.txt"); err == nil {
+		t.Fatal("ReadDir on a file succeeded")
+	}
+}
+
+func TestOverlayGlob(t *testing.T) {
+	overlay, base, _ := newTestOverlay(t)
+
+	for pattern, want := range map[string][]string{
+		"gp/*/*.gp":      {"gp/buildings/mil.gp", "gp/units/dragun.gp", "gp/units/musk.gp", "gp/units/pik.gp"},
+		"GP/UNITS/P*":    {"gp/units/pik.gp"},
+		"*.txt":          {"readme.txt"},
+		"gp/[a-e]*.gp":   {"gp/empty.gp"},
+		"pal/agew_1.pal": {"pal/agew_1.pal"},
+		"missing/*":      nil,
+	} {
+		got, err := overlay.Glob(pattern)
+		if err != nil {
+			t.Fatalf("Glob(%q): %v", pattern, err)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("Glob(%q) = %v, want %v", pattern, got, want)
+		}
+	}
+	if _, err := overlay.Glob("gp/[*"); err == nil {
+		t.Error("Glob with a bad pattern succeeded")
+	}
+
+	got, err := base.Glob("GP/*/M*.GP")
+	if err != nil || !slices.Equal(got, []string{"gp/units/musk.gp"}) {
+		t.Errorf("Container.Glob = %v, %v", got, err)
+	}
+}
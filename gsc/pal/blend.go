@@ -0,0 +1,149 @@
+package pal
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"io"
+
+	"gitgub.com/cam-per/gossacks/gsc/gp"
+)
+
+var (
+	ErrNoTable = errors.New("pal: no blend table for frame type")
+)
+
+// Table is a colour lookup table blending two palette indices: Table[src][dst]
+// is the index drawn where a frame pixel src covers a canvas pixel dst.
+type Table [256][256]uint8
+
+// Shade maps a canvas index to the index drawn where a shadow covers it.
+type Shade [256]uint8
+
+// DecodeTable reads a 65536-byte blend table, rows by source index.
+func (decoder *Decoder) DecodeTable() (*Table, error) {
+	table := &Table{}
+	for i := range table {
+		if _, err := io.ReadFull(decoder.r, table[i][:]); err != nil {
+			return nil, palError(int64(256*i), "reading blend table", err)
+		}
+	}
+	return table, nil
+}
+
+// DecodeShade reads a 256-byte shadow table.
+func (decoder *Decoder) DecodeShade() (*Shade, error) {
+	shade := &Shade{}
+	if _, err := io.ReadFull(decoder.r, shade[:]); err != nil {
+		return nil, palError(0, "reading shadow table", err)
+	}
+	return shade, nil
+}
+
+// NewTable computes the table drawing a source colour with alpha a over the
+// destination, picking the nearest colour of palette.
+func NewTable(palette color.Palette, a uint8) *Table {
+	table := &Table{}
+	for src := range table {
+		for dst := range table[src] {
+			table[src][dst] = uint8(palette.Index(mix(palette, src, dst, uint32(a))))
+		}
+	}
+	return table
+}
+
+// NewShade computes the shadow table darkening every colour of palette to
+// the fraction f/255 of its brightness.
+func NewShade(palette color.Palette, f uint8) *Shade {
+	shade := &Shade{}
+	for dst := range shade {
+		if dst >= len(palette) {
+			continue
+		}
+		r, g, b, _ := palette[dst].RGBA()
+		k := uint32(f)
+		c := color.RGBA{R: uint8(r * k / 255 >> 8), G: uint8(g * k / 255 >> 8), B: uint8(b * k / 255 >> 8), A: 0xFF}
+		shade[dst] = uint8(palette.Index(c))
+	}
+	return shade
+}
+
+func mix(palette color.Palette, src, dst int, a uint32) color.Color {
+	if src >= len(palette) || dst >= len(palette) {
+		return color.Black
+	}
+	sr, sg, sb, _ := palette[src].RGBA()
+	dr, dg, db, _ := palette[dst].RGBA()
+	blend := func(s, d uint32) uint8 { return uint8((s*a + d*(255-a)) / 255 >> 8) }
+	return color.RGBA{R: blend(sr, dr), G: blend(sg, dg), B: blend(sb, db), A: 0xFF}
+}
+
+// Blender draws GP frames on a paletted canvas the way the game does, mixing
+// translucent and shadow frames with lookup tables instead of alpha.
+type Blender struct {
+	Transparent50 *Table
+	Transparent75 *Table
+	Shadow        *Shade
+}
+
+// Draw draws frame at its offset relative to at. Colour frames must be
+// decoded with gp.WithPaletted and are drawn by index; shadow frames only
+// need their mask.
+func (blender *Blender) Draw(dst *image.Paletted, at image.Point, frame *gp.Frame) error {
+	at = at.Add(frame.Rect().Min)
+
+	if frame.Type() == gp.ShadowFrame {
+		if blender.Shadow == nil {
+			return ErrNoTable
+		}
+		if frame.Mask == nil {
+			return nil
+		}
+		b := frame.Mask.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				p := at.Add(image.Pt(x-b.Min.X, y-b.Min.Y))
+				if frame.Mask.AlphaAt(x, y).A == 0 || !p.In(dst.Rect) {
+					continue
+				}
+				i := dst.PixOffset(p.X, p.Y)
+				dst.Pix[i] = blender.Shadow[dst.Pix[i]]
+			}
+		}
+		return nil
+	}
+
+	src, ok := frame.Image.(*image.Paletted)
+	if !ok {
+		return gp.ErrNotPaletted
+	}
+	transparent, _ := frame.TransparentIndex()
+
+	var table *Table
+	switch frame.Type() {
+	case gp.Transparent50Frame:
+		table = blender.Transparent50
+	case gp.Transparent75Frame:
+		table = blender.Transparent75
+	}
+	if table == nil && frame.Type() != gp.StandardFrame && frame.Type() != gp.NationalMaskFrame {
+		return ErrNoTable
+	}
+
+	b := src.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			p := at.Add(image.Pt(x-b.Min.X, y-b.Min.Y))
+			idx := src.Pix[src.PixOffset(x, y)]
+			if idx == transparent || !p.In(dst.Rect) {
+				continue
+			}
+			i := dst.PixOffset(p.X, p.Y)
+			if table != nil {
+				idx = table[idx][dst.Pix[i]]
+			}
+			dst.Pix[i] = idx
+		}
+	}
+	return nil
+}
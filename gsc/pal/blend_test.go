@@ -0,0 +1,163 @@
+package pal
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"gitgub.com/cam-per/gossacks/gsc/gp"
+)
+
+// grayPalette maps every index to the grey of that level, so blends can be
+// checked by index.
+func grayPalette() color.Palette {
+	palette := make(color.Palette, 256)
+	for i := range palette {
+		palette[i] = color.Gray{Y: uint8(i)}
+	}
+	return palette
+}
+
+func TestNewTable(t *testing.T) {
+	palette := grayPalette()
+	half := NewTable(palette, 0x80)
+	for _, tc := range []struct{ src, dst, want uint8 }{
+		{200, 100, 150},
+		{100, 200, 150},
+		{255, 0, 128},
+		{0, 255, 127},
+		{60, 60, 60},
+	} {
+		if got := half[tc.src][tc.dst]; got != tc.want {
+			t.Errorf("50%%: table[%d][%d] = %d, want %d", tc.src, tc.dst, got, tc.want)
+		}
+	}
+
+	opaque, clear := NewTable(palette, 0xFF), NewTable(palette, 0)
+	for src := range 256 {
+		for dst := range 256 {
+			if opaque[src][dst] != uint8(src) || clear[src][dst] != uint8(dst) {
+				t.Fatalf("table[%d][%d] = %d at full and %d at no opacity", src, dst, opaque[src][dst], clear[src][dst])
+			}
+		}
+	}
+}
+
+func TestNewShade(t *testing.T) {
+	shade := NewShade(grayPalette(), 0x80)
+	for _, tc := range []struct{ dst, want uint8 }{{0, 0}, {100, 50}, {200, 100}, {255, 128}} {
+		if got := shade[tc.dst]; got != tc.want {
+			t.Errorf("shade[%d] = %d, want %d", tc.dst, got, tc.want)
+		}
+	}
+	if shade := NewShade(grayPalette(), 0xFF); shade[77] != 77 {
+		t.Errorf("no shading: shade[77] = %d", shade[77])
+	}
+}
+
+func TestDecodeTable(t *testing.T) {
+	want := NewTable(grayPalette(), 0xC0)
+	var data []byte
+	for i := range want {
+		data = append(data, want[i][:]...)
+	}
+	table, err := NewDecoder(bytes.NewReader(data)).DecodeTable()
+	if err != nil || *table != *want {
+		t.Fatalf("DecodeTable: err = %v", err)
+	}
+	if _, err := NewDecoder(bytes.NewReader(data[:1000])).DecodeTable(); err == nil {
+		t.Fatal("truncated table: no error")
+	}
+
+	shade, err := NewDecoder(bytes.NewReader(data[:256])).DecodeShade()
+	if err != nil || !bytes.Equal(shade[:], data[:256]) {
+		t.Fatalf("DecodeShade: err = %v", err)
+	}
+	if _, err := NewDecoder(bytes.NewReader(data[:255])).DecodeShade(); err == nil {
+		t.Fatal("truncated shade: no error")
+	}
+}
+
+// decodeFrame encodes img in palette as a frame of type frameType placed
+// at the top-left corner of its bounds, and decodes it back with opts.
+func decodeFrame(t *testing.T, palette color.Palette, frameType gp.FrameType, img *image.Paletted, opts ...gp.Option) *gp.Frame {
+	t.Helper()
+	var buf bytes.Buffer
+	sprites := []gp.Sprite{{Frames: []*gp.Frame{gp.NewTypedFrame(frameType, img, img.Rect.Min)}}}
+	if err := gp.NewEncoder(&buf, palette).Encode(sprites); err != nil {
+		t.Fatal(err)
+	}
+	decoder, err := gp.NewDecoder(&buf, palette, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decoder.Sprites[0].Frames[0]
+}
+
+// blendFrame decodes a 4x4 frame at (1, 0) of type frameType filled with
+// index 200 but for its transparent first pixel.
+func blendFrame(t *testing.T, frameType gp.FrameType, opts ...gp.Option) *gp.Frame {
+	t.Helper()
+	palette := grayPalette()
+	img := image.NewPaletted(image.Rect(1, 0, 5, 4), append(color.Palette{color.Transparent}, palette[1:]...))
+	for i := range img.Pix {
+		img.Pix[i] = 200
+	}
+	img.Pix[0] = 0
+	return decodeFrame(t, palette, frameType, img, opts...)
+}
+
+func TestBlenderDraw(t *testing.T) {
+	palette := grayPalette()
+	blender := &Blender{
+		Transparent50: NewTable(palette, 0x80),
+		Transparent75: NewTable(palette, 0xC0),
+		Shadow:        NewShade(palette, 0x80),
+	}
+	for _, tc := range []struct {
+		name      string
+		frameType gp.FrameType
+		want      uint8
+	}{
+		{"standard", gp.StandardFrame, 200},
+		{"transparent50", gp.Transparent50Frame, 150},
+		{"transparent75", gp.Transparent75Frame, blender.Transparent75[200][100]},
+		{"shadow", gp.ShadowFrame, 50},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			canvas := image.NewPaletted(image.Rect(0, 0, 6, 6), palette)
+			for i := range canvas.Pix {
+				canvas.Pix[i] = 100
+			}
+			frame := blendFrame(t, tc.frameType, gp.WithPaletted(0))
+			if err := blender.Draw(canvas, image.Pt(3, 3), frame); err != nil {
+				t.Fatal(err)
+			}
+			// The frame covers (4, 3) to (8, 7), clipped to the canvas,
+			// except for its transparent first pixel.
+			for y := 0; y < 6; y++ {
+				for x := 0; x < 6; x++ {
+					want := uint8(100)
+					if x >= 4 && y >= 3 && !(x == 4 && y == 3) {
+						want = tc.want
+					}
+					if got := canvas.ColorIndexAt(x, y); got != want {
+						t.Fatalf("pixel (%d, %d) = %d, want %d", x, y, got, want)
+					}
+				}
+			}
+		})
+	}
+
+	canvas := image.NewPaletted(image.Rect(0, 0, 6, 6), palette)
+	if err := (&Blender{}).Draw(canvas, image.Point{}, blendFrame(t, gp.Transparent50Frame, gp.WithPaletted(0))); err != ErrNoTable {
+		t.Errorf("missing table: err = %v, want %v", err, ErrNoTable)
+	}
+	if err := (&Blender{}).Draw(canvas, image.Point{}, blendFrame(t, gp.ShadowFrame)); err != ErrNoTable {
+		t.Errorf("missing shade: err = %v, want %v", err, ErrNoTable)
+	}
+	if err := blender.Draw(canvas, image.Point{}, blendFrame(t, gp.StandardFrame)); err != gp.ErrNotPaletted {
+		t.Errorf("RGBA frame: err = %v, want %v", err, gp.ErrNotPaletted)
+	}
+}
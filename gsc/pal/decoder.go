@@ -1,8 +1,11 @@
 package pal
 
 import (
+	"fmt"
 	"image/color"
 	"io"
+
+	"gitgub.com/cam-per/gossacks/gsc/internal/decode"
 )
 
 type Channel uint8
@@ -42,14 +45,20 @@ func (decoder *Decoder) Decode(paletteType Channel, size int) (color.Palette, er
 		depth = 3
 	case ChannelARGB:
 		depth = 4
+	default:
+		return nil, decode.NewError("pal", fmt.Sprintf("unknown channel %d", paletteType), nil)
+	}
+	if size < 0 {
+		return nil, decode.NewError("pal", fmt.Sprintf("negative size %d", size), nil)
 	}
-	pal := make([]color.Color, size)
+	// The size is up to the caller; grow with the input rather than trust it.
+	pal := make([]color.Color, 0, min(size, 256))
 	buf := make([]byte, depth)
 
 	for i := 0; i < size; i++ {
 		var c color.Color
-		if _, err := decoder.r.Read(buf); err != nil {
-			return nil, err
+		if _, err := io.ReadFull(decoder.r, buf); err != nil {
+			return nil, decode.NewError("pal", fmt.Sprintf("reading colour %d", i), err).At(int64(i * depth))
 		}
 		switch paletteType {
 		case ChannelAlpha:
@@ -67,7 +76,7 @@ func (decoder *Decoder) Decode(paletteType Channel, size int) (color.Palette, er
 		case ChannelARGB:
 			c = color.RGBA{R: buf[1], G: buf[2], B: buf[3], A: buf[0]}
 		}
-		pal[i] = c
+		pal = append(pal, c)
 	}
 	return pal, nil
 }
@@ -0,0 +1,29 @@
+package pal
+
+import (
+	"bytes"
+	"testing"
+)
+
+func FuzzDecoder(f *testing.F) {
+	gray := make([]byte, 768)
+	for i := range gray {
+		gray[i] = byte(i / 3)
+	}
+	f.Add(gray)
+	f.Add([]byte("JASC-PAL\r\n0100\r\n2\r\n0 0 0\r\n255 128 7\r\n"))
+	var riff bytes.Buffer
+	if err := NewEncoder(&riff).Encode(FromRGB(gray), LayoutRIFF); err != nil {
+		f.Fatal(err)
+	}
+	f.Add(riff.Bytes())
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		NewDecoder(bytes.NewReader(data)).DecodeAuto()
+		NewDecoder(bytes.NewReader(data)).DecodeTable()
+		NewDecoder(bytes.NewReader(data)).DecodeShade()
+		if len(data) > 0 {
+			NewDecoder(bytes.NewReader(data[1:])).Decode(Channel(data[0]%8), int(int8(data[0])))
+		}
+	})
+}
@@ -0,0 +1,61 @@
+package pal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"strings"
+)
+
+type Encoder struct {
+	w io.Writer
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes palette in the given layout. LayoutVGA keeps the top six bits
+// of every component.
+func (encoder *Encoder) Encode(palette color.Palette, layout Layout) error {
+	var data []byte
+	switch layout {
+	case LayoutRaw:
+		data = RGB(palette)
+	case LayoutVGA:
+		data = RGB(palette)
+		for i := range data {
+			data[i] >>= 2
+		}
+	case LayoutJASC:
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s\r\n%s\r\n%d\r\n", jascMagic, jascVersion, len(palette))
+		rgb := RGB(palette)
+		for i := 0; i < len(rgb); i += 3 {
+			fmt.Fprintf(&b, "%d %d %d\r\n", rgb[i], rgb[i+1], rgb[i+2])
+		}
+		data = []byte(b.String())
+	case LayoutRIFF:
+		if len(palette) > math.MaxUint16 {
+			return fmt.Errorf("pal: too many colours for RIFF PAL: %d", len(palette))
+		}
+		size := 4 + 4*len(palette)
+		data = make([]byte, 0, 20+size)
+		data = append(data, "RIFF"...)
+		data = binary.LittleEndian.AppendUint32(data, uint32(12+size))
+		data = append(data, "PAL data"...)
+		data = binary.LittleEndian.AppendUint32(data, uint32(size))
+		data = binary.LittleEndian.AppendUint16(data, riffVersion)
+		data = binary.LittleEndian.AppendUint16(data, uint16(len(palette)))
+		rgb := RGB(palette)
+		for i := 0; i < len(rgb); i += 3 {
+			data = append(data, rgb[i], rgb[i+1], rgb[i+2], 0)
+		}
+	default:
+		return ErrUnknownLayout
+	}
+	_, err := encoder.w.Write(data)
+	return err
+}
@@ -0,0 +1,25 @@
+package pal
+
+import (
+	"io"
+
+	"gitgub.com/cam-per/gossacks/gsc"
+)
+
+func init() {
+	// Raw and VGA palettes carry no signature and are only recognised by
+	// extension.
+	jasc := gsc.Magic(jascMagic)
+	gsc.RegisterFormat(gsc.Format{
+		Name:       "pal",
+		Extensions: []string{".pal"},
+		Sniff: func(r io.ReaderAt, size int64) bool {
+			if jasc(r, size) {
+				return true
+			}
+			head := make([]byte, 12)
+			n, _ := r.ReadAt(head, 0)
+			return isRIFF(head[:n])
+		},
+	})
+}
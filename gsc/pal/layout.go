@@ -0,0 +1,256 @@
+package pal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+
+	"gitgub.com/cam-per/gossacks/gsc/internal/decode"
+)
+
+var (
+	ErrUnknownLayout = errors.New("pal: unknown palette layout")
+)
+
+// Layout is a palette file layout.
+type Layout uint8
+
+const (
+	// LayoutRaw is a headerless run of 8-bit RGB triplets, 768 bytes for the
+	// 256 colours of the game palettes.
+	LayoutRaw Layout = iota
+	// LayoutVGA is LayoutRaw with 6-bit components, as found in VGA DAC
+	// dumps.
+	LayoutVGA
+	// LayoutJASC is the JASC-PAL text format read by GIMP and Aseprite.
+	LayoutJASC
+	// LayoutRIFF is the Microsoft RIFF PAL format.
+	LayoutRIFF
+)
+
+func (layout Layout) String() string {
+	switch layout {
+	case LayoutRaw:
+		return "raw"
+	case LayoutVGA:
+		return "vga"
+	case LayoutJASC:
+		return "jasc"
+	case LayoutRIFF:
+		return "riff"
+	}
+	return "Layout(" + strconv.Itoa(int(layout)) + ")"
+}
+
+const (
+	jascMagic   = "JASC-PAL"
+	jascVersion = "0100"
+	riffVersion = 0x0300
+	maxColors   = 1 << 16
+)
+
+// DecodeAuto reads a palette in any Layout and reports which one it was.
+// JASC-PAL and RIFF PAL files are told by their header. Headerless files are
+// guessed at: when all their components fit in 6 bits they are taken as
+// LayoutVGA and scaled to 8 bits, so a raw palette that dark is misread. Use
+// DecodeLayout when the layout is known.
+func (decoder *Decoder) DecodeAuto() (color.Palette, Layout, error) {
+	data, err := io.ReadAll(decoder.r)
+	if err != nil {
+		return nil, 0, err
+	}
+	layout, err := detectLayout(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	p, err := decodeLayout(data, layout)
+	return p, layout, err
+}
+
+// DecodeLayout reads a palette in the given layout.
+func (decoder *Decoder) DecodeLayout(layout Layout) (color.Palette, error) {
+	data, err := io.ReadAll(decoder.r)
+	if err != nil {
+		return nil, err
+	}
+	return decodeLayout(data, layout)
+}
+
+func detectLayout(data []byte) (Layout, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte(jascMagic)):
+		return LayoutJASC, nil
+	case isRIFF(data):
+		return LayoutRIFF, nil
+	case len(data) > 0 && len(data)%3 == 0:
+		if isVGA(data) {
+			return LayoutVGA, nil
+		}
+		return LayoutRaw, nil
+	}
+	return 0, palError(-1, "", ErrUnknownLayout)
+}
+
+func decodeLayout(data []byte, layout Layout) (color.Palette, error) {
+	switch layout {
+	case LayoutRaw, LayoutVGA:
+		if len(data)%3 != 0 {
+			return nil, palError(int64(len(data)-len(data)%3), "partial RGB triplet", io.ErrUnexpectedEOF)
+		}
+		if layout == LayoutVGA {
+			if !isVGA(data) {
+				return nil, palError(-1, "component above 6 bits in VGA palette", nil)
+			}
+			data = scaleVGA(data)
+		}
+		return FromRGB(data), nil
+	case LayoutJASC:
+		return decodeJASC(data)
+	case LayoutRIFF:
+		if !isRIFF(data) {
+			return nil, palError(0, "missing RIFF PAL header", nil)
+		}
+		return decodeRIFF(data)
+	}
+	return nil, palError(-1, "", ErrUnknownLayout)
+}
+
+// FromRGB returns the palette of the RGB triplets in p. A trailing partial
+// triplet is ignored.
+func FromRGB(p []byte) color.Palette {
+	palette := make(color.Palette, len(p)/3)
+	for i := range palette {
+		palette[i] = color.RGBA{R: p[3*i], G: p[3*i+1], B: p[3*i+2], A: 0xFF}
+	}
+	return palette
+}
+
+// RGB returns the colours of palette as RGB triplets, dropping alpha.
+func RGB(palette color.Palette) []byte {
+	p := make([]byte, 0, 3*len(palette))
+	for _, c := range palette {
+		rgba := color.RGBAModel.Convert(c).(color.RGBA)
+		p = append(p, rgba.R, rgba.G, rgba.B)
+	}
+	return p
+}
+
+func isVGA(p []byte) bool {
+	for _, v := range p {
+		if v > 0x3F {
+			return false
+		}
+	}
+	return true
+}
+
+func scaleVGA(p []byte) []byte {
+	out := make([]byte, len(p))
+	for i, v := range p {
+		out[i] = v<<2 | v>>4
+	}
+	return out
+}
+
+func isRIFF(p []byte) bool {
+	return len(p) >= 12 && string(p[:4]) == "RIFF" && string(p[8:12]) == "PAL "
+}
+
+func decodeJASC(data []byte) (color.Palette, error) {
+	offset, next := 0, 0
+	line := func() (string, error) {
+		offset = next
+		if offset >= len(data) {
+			return "", palError(int64(offset), "JASC-PAL file cut short", io.ErrUnexpectedEOF)
+		}
+		end := bytes.IndexByte(data[offset:], '\n')
+		if end < 0 {
+			end = len(data) - offset
+			next = len(data)
+		} else {
+			next = offset + end + 1
+		}
+		return strings.TrimSpace(string(data[offset : offset+end])), nil
+	}
+
+	for _, want := range []string{jascMagic, jascVersion} {
+		got, err := line()
+		if err != nil {
+			return nil, err
+		}
+		if got != want {
+			return nil, palError(int64(offset), fmt.Sprintf("bad JASC-PAL header %q", got), nil)
+		}
+	}
+	s, err := line()
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.Atoi(s)
+	if err != nil || count < 0 || count > maxColors {
+		return nil, palError(int64(offset), fmt.Sprintf("bad JASC-PAL colour count %q", s), nil)
+	}
+
+	// Every colour takes a line of at least six bytes.
+	palette := make(color.Palette, 0, min(count, len(data)/6))
+	for range count {
+		s, err := line()
+		if err != nil {
+			return nil, err
+		}
+		fields := strings.Fields(s)
+		if len(fields) < 3 {
+			return nil, palError(int64(offset), fmt.Sprintf("bad JASC-PAL colour %q", s), nil)
+		}
+		var rgb [3]uint8
+		for j := range rgb {
+			v, err := strconv.ParseUint(fields[j], 10, 8)
+			if err != nil {
+				return nil, palError(int64(offset), fmt.Sprintf("bad JASC-PAL colour %q", s), nil)
+			}
+			rgb[j] = uint8(v)
+		}
+		palette = append(palette, color.RGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 0xFF})
+	}
+	return palette, nil
+}
+
+// decodeRIFF reads the "data" chunk of a RIFF PAL file: a version, a colour
+// count and one (R, G, B, flags) entry per colour.
+func decodeRIFF(data []byte) (color.Palette, error) {
+	for p := data[12:]; len(p) >= 8; {
+		offset := int64(len(data) - len(p))
+		id, size := string(p[:4]), binary.LittleEndian.Uint32(p[4:])
+		p = p[8:]
+		if uint64(size) > uint64(len(p)) {
+			return nil, palError(offset, fmt.Sprintf("RIFF chunk %q cut short", id), io.ErrUnexpectedEOF)
+		}
+		if id != "data" {
+			p = p[min(int(size+size&1), len(p)):]
+			continue
+		}
+		if size < 4 {
+			return nil, palError(offset, "RIFF data chunk too small", io.ErrUnexpectedEOF)
+		}
+		count := int(binary.LittleEndian.Uint16(p[2:]))
+		if 4+4*count > int(size) {
+			return nil, palError(offset, fmt.Sprintf("RIFF data chunk too small for %d colours", count), io.ErrUnexpectedEOF)
+		}
+		palette := make(color.Palette, count)
+		for i := range palette {
+			e := p[4+4*i:]
+			palette[i] = color.RGBA{R: e[0], G: e[1], B: e[2], A: 0xFF}
+		}
+		return palette, nil
+	}
+	return nil, palError(-1, "RIFF PAL without data chunk", nil)
+}
+
+func palError(offset int64, reason string, err error) error {
+	return decode.NewError("pal", reason, err).At(offset)
+}
@@ -0,0 +1,118 @@
+package pal
+
+import (
+	"bytes"
+	"image/color"
+	"testing"
+)
+
+// testPalette returns n colours whose components survive the 6-bit VGA
+// layout when vga is set.
+func testPalette(n int, vga bool) color.Palette {
+	palette := make(color.Palette, n)
+	for i := range palette {
+		rgb := [3]uint8{uint8(i), uint8(255 - i), uint8(i * 7)}
+		if vga {
+			for j, v := range rgb {
+				v >>= 2
+				rgb[j] = v<<2 | v>>4
+			}
+		}
+		palette[i] = color.RGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 0xFF}
+	}
+	return palette
+}
+
+func equalPalettes(a, b color.Palette) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if color.RGBAModel.Convert(a[i]) != color.RGBAModel.Convert(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestLayoutRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		layout  Layout
+		palette color.Palette
+	}{
+		{LayoutRaw, testPalette(256, false)},
+		{LayoutVGA, testPalette(16, true)},
+		{LayoutVGA, testPalette(256, true)},
+		{LayoutJASC, testPalette(256, false)},
+		{LayoutJASC, testPalette(3, false)},
+		{LayoutRIFF, testPalette(256, false)},
+		{LayoutRIFF, testPalette(0, false)},
+	} {
+		var buf bytes.Buffer
+		if err := NewEncoder(&buf).Encode(tc.palette, tc.layout); err != nil {
+			t.Fatal(err)
+		}
+		data := buf.Bytes()
+
+		p, layout, err := NewDecoder(bytes.NewReader(data)).DecodeAuto()
+		if err != nil {
+			t.Fatalf("%v: %v", tc.layout, err)
+		}
+		if layout != tc.layout || !equalPalettes(p, tc.palette) {
+			t.Errorf("%v: DecodeAuto = %v with %d colours", tc.layout, layout, len(p))
+		}
+
+		p, err = NewDecoder(bytes.NewReader(data)).DecodeLayout(tc.layout)
+		if err != nil {
+			t.Fatalf("%v: %v", tc.layout, err)
+		}
+		if !equalPalettes(p, tc.palette) {
+			t.Errorf("%v: DecodeLayout differs", tc.layout)
+		}
+	}
+}
+
+func TestLayoutDetect(t *testing.T) {
+	// A 768-byte VGA DAC dump is told from a raw palette by its 6-bit
+	// components; a raw palette that dark needs its layout given.
+	dump := make([]byte, 3*256)
+	for i := range dump {
+		dump[i] = byte(i % 0x40)
+	}
+	p, layout, err := NewDecoder(bytes.NewReader(dump)).DecodeAuto()
+	if err != nil || layout != LayoutVGA || !equalPalettes(p, FromRGB(scaleVGA(dump))) {
+		t.Fatalf("VGA dump: layout = %v, err = %v", layout, err)
+	}
+	p, err = NewDecoder(bytes.NewReader(dump)).DecodeLayout(LayoutRaw)
+	if err != nil || !equalPalettes(p, FromRGB(dump)) {
+		t.Fatalf("explicit raw layout: err = %v", err)
+	}
+	dump[len(dump)-1] = 0x40
+	if _, layout, _ := NewDecoder(bytes.NewReader(dump)).DecodeAuto(); layout != LayoutRaw {
+		t.Errorf("768 bytes above 6 bits: layout = %v, want %v", layout, LayoutRaw)
+	}
+
+	bright := RGB(testPalette(16, false))
+	if _, layout, _ := NewDecoder(bytes.NewReader(bright)).DecodeAuto(); layout != LayoutRaw {
+		t.Errorf("bright 16-colour palette: layout = %v, want %v", layout, LayoutRaw)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		data   []byte
+		layout Layout
+	}{
+		{"VGA above 6 bits", bright, LayoutVGA},
+		{"partial triplet", bright[:len(bright)-1], LayoutRaw},
+		{"RIFF without header", bright, LayoutRIFF},
+		{"JASC without header", bright, LayoutJASC},
+		{"unknown layout", bright, Layout(9)},
+	} {
+		if _, err := NewDecoder(bytes.NewReader(tc.data)).DecodeLayout(tc.layout); err == nil {
+			t.Errorf("%s: no error", tc.name)
+		}
+	}
+	if _, _, err := NewDecoder(bytes.NewReader(bright[:4])).DecodeAuto(); err == nil {
+		t.Error("4 bytes: no error")
+	}
+}
@@ -0,0 +1,157 @@
+package pal
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+
+	"gitgub.com/cam-per/gossacks/gsc/gp"
+)
+
+var (
+	ErrNation = errors.New("pal: nation index out of range")
+	ErrNoRun  = errors.New("pal: national colour run not set")
+)
+
+// Nations describes the run of Count palette indices from First on that
+// national mask frames draw with, and how each nation recolours it. The
+// nation colours are not built in: they come from Runs, read from the game
+// palette, or from Colors. A Nations with no run, or with neither Runs nor
+// Colors, is an error to use.
+type Nations struct {
+	First, Count int
+	// Runs holds, per nation, the first index of the copy of the run in the
+	// nation's colours that the base palette carries. When set, national
+	// pixels are remapped to those indices.
+	Runs []int
+	// Colors holds one colour per nation the run is shaded in when Runs is
+	// nil.
+	Colors []color.RGBA
+}
+
+// check validates the run and nation, the run and its copy of which must
+// lie in a palette of n colours.
+func (nations *Nations) check(nation, n int) error {
+	if nations.Count <= 0 || nations.First < 0 || nations.First+nations.Count > n {
+		return ErrNoRun
+	}
+	count := len(nations.Colors)
+	if nations.Runs != nil {
+		count = len(nations.Runs)
+	}
+	if count == 0 {
+		return ErrNoRun
+	}
+	if nation < 0 || nation >= count {
+		return ErrNation
+	}
+	if nations.Runs != nil && (nations.Runs[nation] < 0 || nations.Runs[nation]+nations.Count > n) {
+		return ErrNation
+	}
+	return nil
+}
+
+// Remap returns the index table drawing the national run in the colours of
+// nation: every index of the run maps to the same entry of the nation's copy
+// given by Runs, every other index to itself. It needs Runs.
+func (nations *Nations) Remap(nation int) (*Shade, error) {
+	if nations.Runs == nil {
+		return nil, ErrNoRun
+	}
+	if err := nations.check(nation, 256); err != nil {
+		return nil, err
+	}
+	remap := &Shade{}
+	for i := range remap {
+		remap[i] = uint8(i)
+	}
+	for k := 0; k < nations.Count; k++ {
+		remap[nations.First+k] = uint8(nations.Runs[nation] + k)
+	}
+	return remap, nil
+}
+
+// Option returns the gp decoding option that gives national mask frames a
+// Mask of the pixels drawn with the national run.
+func (nations *Nations) Option() gp.Option {
+	return gp.WithNationalColors(nations.First, nations.Count)
+}
+
+// Palette returns base with the national run recoloured for nation. With
+// Runs the run takes the colours of the nation's copy of it; otherwise every
+// entry keeps its brightness relative to the brightest one and takes the hue
+// of the nation colour.
+func (nations *Nations) Palette(base color.Palette, nation int) (color.Palette, error) {
+	if err := nations.check(nation, len(base)); err != nil {
+		return nil, err
+	}
+	first, last := nations.First, nations.First+nations.Count
+
+	p := make(color.Palette, len(base))
+	copy(p, base)
+	if nations.Runs != nil {
+		copy(p[first:last], base[nations.Runs[nation]:])
+		return p, nil
+	}
+
+	peak := uint32(1)
+	for i := first; i < last; i++ {
+		peak = max(peak, luma(base[i]))
+	}
+	c := nations.Colors[nation]
+	for i := first; i < last; i++ {
+		l := luma(base[i])
+		p[i] = color.RGBA{
+			R: uint8(uint32(c.R) * l / peak),
+			G: uint8(uint32(c.G) * l / peak),
+			B: uint8(uint32(c.B) * l / peak),
+			A: 0xFF,
+		}
+	}
+	return p, nil
+}
+
+// Apply returns frame drawn in the colours of nation. Frames decoded with
+// gp.WithPaletted are repainted; other national mask frames, decoded with
+// Option, have the pixels under their mask recoloured. Frames of other types
+// or without a mask are returned unchanged.
+func (nations *Nations) Apply(frame *gp.Frame, base color.Palette, nation int) (image.Image, error) {
+	p, err := nations.Palette(base, nation)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := frame.Image.(*image.Paletted); ok {
+		return frame.Repaint(p)
+	}
+	if frame.Type() != gp.NationalMaskFrame || frame.Mask == nil {
+		return frame.Image, nil
+	}
+
+	remap := make(map[color.RGBA]color.Color, nations.Count)
+	for i := nations.First; i < nations.First+nations.Count; i++ {
+		remap[color.RGBAModel.Convert(base[i]).(color.RGBA)] = p[i]
+	}
+
+	b := frame.Image.Bounds()
+	out := image.NewRGBA(b)
+	draw.Draw(out, b, frame.Image, b.Min, draw.Src)
+	mb := frame.Mask.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if frame.Mask.AlphaAt(mb.Min.X+x-b.Min.X, mb.Min.Y+y-b.Min.Y).A == 0 {
+				continue
+			}
+			if c, ok := remap[out.RGBAAt(x, y)]; ok {
+				out.Set(x, y, c)
+			}
+		}
+	}
+	return out, nil
+}
+
+// luma returns the Rec. 601 brightness of c in 0..0xFFFF.
+func luma(c color.Color) uint32 {
+	r, g, b, _ := c.RGBA()
+	return (299*r + 587*g + 114*b) / 1000
+}
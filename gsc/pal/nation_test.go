@@ -0,0 +1,131 @@
+package pal
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"gitgub.com/cam-per/gossacks/gsc/gp"
+)
+
+// nationFrame decodes a 4x1 national mask frame drawing indices 1, 16, 17
+// and 19.
+func nationFrame(t *testing.T, base color.Palette, opts ...gp.Option) *gp.Frame {
+	t.Helper()
+	img := image.NewPaletted(image.Rect(0, 0, 4, 1), base)
+	copy(img.Pix, []uint8{1, 16, 17, 19})
+	return decodeFrame(t, base, gp.NationalMaskFrame, img, opts...)
+}
+
+func TestNationsRuns(t *testing.T) {
+	base := testPalette(256, false)
+	nations := &Nations{First: 16, Count: 4}
+	for p := range 8 {
+		nations.Runs = append(nations.Runs, 16+4*p)
+	}
+	rgba := nationFrame(t, base, nations.Option())
+	paletted := nationFrame(t, base, nations.Option(), gp.WithPaletted(0))
+
+	for p, run := range nations.Runs {
+		remap, err := nations.Remap(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, got := range remap {
+			want := i
+			if i >= 16 && i < 20 {
+				want = run + i - 16
+			}
+			if int(got) != want {
+				t.Fatalf("player %d: remap[%d] = %d, want %d", p, i, got, want)
+			}
+		}
+
+		palette, err := nations.Palette(base, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalPalettes(palette[16:20], base[run:run+4]) || !equalPalettes(palette[:16], base[:16]) || !equalPalettes(palette[20:], base[20:]) {
+			t.Fatalf("player %d: palette differs outside of the remapped run", p)
+		}
+
+		// Pixel x is drawn with index want[x] of the base palette.
+		want := []int{1, run, run + 1, run + 3}
+		for _, frame := range []*gp.Frame{rgba, paletted} {
+			img, err := nations.Apply(frame, base, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for x, idx := range want {
+				if got := color.RGBAModel.Convert(img.At(x, 0)); got != base[idx] {
+					t.Fatalf("player %d, %T: pixel %d = %v, want index %d", p, frame.Image, x, got, idx)
+				}
+			}
+		}
+	}
+}
+
+// nationColors are the colours the tests shade national runs in.
+var nationColors = []color.RGBA{
+	{R: 0xFF, A: 0xFF},
+	{G: 0xFF, A: 0xFF},
+	{R: 0x20, G: 0x40, B: 0xE0, A: 0xFF},
+}
+
+func TestNationsColors(t *testing.T) {
+	base := testPalette(256, false)
+	base[16] = color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}
+	base[17] = color.RGBA{R: 0x80, G: 0x80, B: 0x80, A: 0xFF}
+	nations := &Nations{First: 16, Count: 2, Colors: nationColors}
+	for p, c := range nationColors {
+		palette, err := nations.Palette(base, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := palette[16]; got != c {
+			t.Errorf("player %d: brightest entry = %v, want %v", p, got, c)
+		}
+		half := color.RGBA{R: uint8(uint32(c.R) * 0x8080 / 0xFFFF), G: uint8(uint32(c.G) * 0x8080 / 0xFFFF), B: uint8(uint32(c.B) * 0x8080 / 0xFFFF), A: 0xFF}
+		if got := palette[17]; got != half {
+			t.Errorf("player %d: half-bright entry = %v, want %v", p, got, half)
+		}
+	}
+	if _, err := nations.Remap(0); err != ErrNoRun {
+		t.Errorf("Remap without runs: err = %v, want %v", err, ErrNoRun)
+	}
+}
+
+func TestNationsErrors(t *testing.T) {
+	base := testPalette(256, false)
+	for _, tc := range []struct {
+		name    string
+		nations Nations
+		nation  int
+		err     error
+	}{
+		{"zero value", Nations{}, 0, ErrNoRun},
+		{"negative first", Nations{First: -1, Count: 4}, 0, ErrNoRun},
+		{"negative nation", Nations{First: 16, Count: 4, Colors: nationColors}, -1, ErrNation},
+		{"neither runs nor colours", Nations{First: 16, Count: 4}, 0, ErrNoRun},
+		{"run past the palette", Nations{First: 250, Count: 8, Runs: []int{0}}, 0, ErrNoRun},
+		{"past the colours", Nations{First: 16, Count: 4, Colors: nationColors}, len(nationColors), ErrNation},
+		{"past the runs", Nations{First: 16, Count: 4, Runs: []int{16}}, 1, ErrNation},
+		{"run outside the palette", Nations{First: 16, Count: 4, Runs: []int{254}}, 0, ErrNation},
+	} {
+		if _, err := tc.nations.Palette(base, tc.nation); err != tc.err {
+			t.Errorf("%s: Palette err = %v, want %v", tc.name, err, tc.err)
+		}
+		if _, err := tc.nations.Apply(nationFrame(t, base), base, tc.nation); err != tc.err {
+			t.Errorf("%s: Apply err = %v, want %v", tc.name, err, tc.err)
+		}
+	}
+
+	// The run itself must fit in the base palette, not only its copies.
+	nations := Nations{First: 200, Count: 8, Runs: []int{0}}
+	if _, err := nations.Palette(base[:16], 0); err != ErrNoRun {
+		t.Errorf("run past a 16-colour palette: Palette err = %v, want %v", err, ErrNoRun)
+	}
+	if _, err := nations.Apply(nationFrame(t, base), base[:16], 0); err != ErrNoRun {
+		t.Errorf("run past a 16-colour palette: Apply err = %v, want %v", err, ErrNoRun)
+	}
+}
@@ -0,0 +1,125 @@
+package rlc
+
+import (
+	"bufio"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+
+	"gitgub.com/cam-per/gossacks/gsc/gp"
+	"gitgub.com/cam-per/gossacks/gsc/internal/decode"
+)
+
+type Decoder struct {
+	header      header
+	fmap        []byte
+	palette     color.Palette
+	imageType   gp.ImageType
+	shadowColor color.Color
+	Pictures    []*Picture
+}
+
+// Option configures a Decoder.
+type Option func(*Decoder)
+
+// WithShadowColor sets the colour the pixels of shadow pictures are drawn
+// with. The default is half-transparent black.
+func WithShadowColor(c color.Color) Option {
+	return func(decoder *Decoder) { decoder.shadowColor = c }
+}
+
+func NewDecoder(r io.Reader, palette color.Palette, opts ...Option) (*Decoder, error) {
+	data, err := io.ReadAll(bufio.NewReader(r))
+	if err != nil {
+		return nil, err
+	}
+	decoder := &Decoder{
+		fmap:        data,
+		palette:     palette,
+		shadowColor: color.NRGBA{A: 0x80},
+	}
+	for _, opt := range opts {
+		opt(decoder)
+	}
+	if err := decoder.decode(); err != nil {
+		return nil, err
+	}
+	return decoder, nil
+}
+
+// Type reports whether the decoded file holds colour or shadow pictures.
+func (decoder *Decoder) Type() gp.ImageType { return decoder.imageType }
+
+func (decoder *Decoder) decode() error {
+	offsets, err := pictureOffsets(decoder.fmap)
+	if err != nil {
+		return err
+	}
+	copy(decoder.header.Sign[:], decoder.fmap)
+	decoder.header.PicturesCount = int16(len(offsets))
+
+	if decoder.imageType = Detect(decoder.fmap); decoder.imageType == gp.ImageInvalid {
+		// Report why the pictures do not parse as colour ones.
+		for i, offset := range offsets {
+			if _, err := walkPicture(decoder.fmap, int64(offset), true, nil); err != nil {
+				return pictureError(i, err)
+			}
+		}
+		return formatError(-1, "pictures parse as neither colour nor shadow ones")
+	}
+
+	decoder.Pictures = make([]*Picture, len(offsets))
+	for i, offset := range offsets {
+		picture, err := decoder.decodePicture(int64(offset))
+		if err != nil {
+			return pictureError(i, err)
+		}
+		decoder.Pictures[i] = picture
+	}
+	return nil
+}
+
+func (decoder *Decoder) decodePicture(offset int64) (*Picture, error) {
+	size, err := pictureSize(decoder.fmap, offset)
+	if err != nil {
+		return nil, err
+	}
+	picture := &Picture{offset: offset}
+	bounds := image.Rectangle{Max: size}
+
+	if decoder.imageType == gp.ImageShadowRLC {
+		canvas := image.NewNRGBA(bounds)
+		picture.Image = canvas
+		picture.Mask = image.NewAlpha(bounds)
+		_, err = walkPicture(decoder.fmap, offset, false, func(x, y, n int, _ []byte) {
+			for i := 0; i < n; i++ {
+				canvas.Set(x+i, y, decoder.shadowColor)
+				picture.Mask.SetAlpha(x+i, y, color.Alpha{A: 0xFF})
+			}
+		})
+		return picture, err
+	}
+
+	canvas := image.NewRGBA(bounds)
+	picture.Image = canvas
+	_, err = walkPicture(decoder.fmap, offset, true, func(x, y, n int, p []byte) {
+		for i, idx := range p {
+			if int(idx) < len(decoder.palette) {
+				canvas.Set(x+i, y, decoder.palette[idx])
+			}
+		}
+	})
+	return picture, err
+}
+
+// pictureError locates err in picture i.
+func pictureError(i int, err error) error {
+	var de *decode.Error
+	if errors.As(err, &de) {
+		c := *de
+		c.Sprite = i
+		return &c
+	}
+	return err
+}
@@ -0,0 +1,191 @@
+package rlc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+
+	"gitgub.com/cam-per/gossacks/gsc"
+	"gitgub.com/cam-per/gossacks/gsc/gp"
+)
+
+type segment struct {
+	space int
+	pix   []byte
+}
+
+type testPicture struct {
+	w, h int
+	rows [][]segment
+}
+
+// build lays out pictures as an RLC file, with the palette indices of every
+// segment when colour is set.
+func build(colour bool, pictures ...testPicture) []byte {
+	data := append([]byte(nil), signature[:]...)
+	data = append(data, 0)
+	data = binary.LittleEndian.AppendUint16(data, uint16(len(pictures)))
+	table := len(data)
+	data = append(data, make([]byte, 4*len(pictures))...)
+	for i, p := range pictures {
+		binary.LittleEndian.PutUint32(data[table+4*i:], uint32(len(data)))
+		data = binary.LittleEndian.AppendUint16(data, uint16(p.w))
+		data = binary.LittleEndian.AppendUint16(data, uint16(p.h))
+		for y := 0; y < p.h; y++ {
+			var row []segment
+			if y < len(p.rows) {
+				row = p.rows[y]
+			}
+			data = append(data, byte(len(row)))
+			for _, s := range row {
+				data = append(data, byte(s.space), byte(len(s.pix)))
+				if colour {
+					data = append(data, s.pix...)
+				}
+			}
+		}
+	}
+	return data
+}
+
+func testPalette() color.Palette {
+	palette := make(color.Palette, 256)
+	for i := range palette {
+		palette[i] = color.RGBA{R: uint8(i), G: uint8(255 - i), B: uint8(i * 3), A: 0xFF}
+	}
+	return palette
+}
+
+var testPictures = []testPicture{
+	{w: 6, h: 3, rows: [][]segment{
+		{{0, []byte{1, 2}}, {2, []byte{3, 4}}},
+		{},
+		{{5, []byte{200}}},
+	}},
+	{w: 2, h: 1, rows: [][]segment{{{0, []byte{7, 8}}}}},
+	{w: 0, h: 0},
+}
+
+func TestDecodeColour(t *testing.T) {
+	palette := testPalette()
+	data := build(true, testPictures...)
+	if got := Detect(data); got != gp.ImageRLC {
+		t.Fatalf("Detect = %d, want %d", got, gp.ImageRLC)
+	}
+	decoder, err := NewDecoder(bytes.NewReader(data), palette)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoder.Type() != gp.ImageRLC || len(decoder.Pictures) != len(testPictures) {
+		t.Fatalf("type %d with %d pictures", decoder.Type(), len(decoder.Pictures))
+	}
+	for i, want := range testPictures {
+		picture := decoder.Pictures[i]
+		if picture.Mask != nil {
+			t.Errorf("picture %d: colour picture has a mask", i)
+		}
+		if b := picture.Bounds(); b != image.Rect(0, 0, want.w, want.h) {
+			t.Fatalf("picture %d: bounds = %v", i, b)
+		}
+		drawn := make(map[image.Point]byte)
+		for y, row := range want.rows {
+			x := 0
+			for _, s := range row {
+				x += s.space
+				for _, idx := range s.pix {
+					drawn[image.Pt(x, y)] = idx
+					x++
+				}
+			}
+		}
+		for y := 0; y < want.h; y++ {
+			for x := 0; x < want.w; x++ {
+				got := color.RGBAModel.Convert(picture.At(x, y))
+				var exp color.Color = color.RGBA{}
+				if idx, ok := drawn[image.Pt(x, y)]; ok {
+					exp = palette[idx]
+				}
+				if got != exp {
+					t.Fatalf("picture %d: pixel (%d, %d) = %v, want %v", i, x, y, got, exp)
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeShadow(t *testing.T) {
+	data := build(false, testPictures[:2]...)
+	if got := Detect(data); got != gp.ImageShadowRLC {
+		t.Fatalf("Detect = %d, want %d", got, gp.ImageShadowRLC)
+	}
+	shadow := color.NRGBA{R: 1, G: 2, B: 3, A: 0x40}
+	decoder, err := NewDecoder(bytes.NewReader(data), testPalette(), WithShadowColor(shadow))
+	if err != nil {
+		t.Fatal(err)
+	}
+	picture := decoder.Pictures[0]
+	for _, tc := range []struct {
+		x, y  int
+		drawn bool
+	}{{0, 0, true}, {1, 0, true}, {2, 0, false}, {4, 0, true}, {0, 1, false}, {5, 2, true}, {4, 2, false}} {
+		if got := picture.Mask.AlphaAt(tc.x, tc.y).A != 0; got != tc.drawn {
+			t.Errorf("mask (%d, %d) = %v, want %v", tc.x, tc.y, got, tc.drawn)
+		}
+		want := color.NRGBA{}
+		if tc.drawn {
+			want = shadow
+		}
+		if got := picture.Image.(*image.NRGBA).NRGBAAt(tc.x, tc.y); got != want {
+			t.Errorf("pixel (%d, %d) = %v, want %v", tc.x, tc.y, got, want)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	data := build(true, testPictures...)
+	second := int64(binary.LittleEndian.Uint32(data[headerSize+4:]))
+
+	wide := build(true, testPicture{w: 3, h: 1, rows: [][]segment{{{2, []byte{1, 2}}}}})
+	huge := build(true, testPicture{w: 0x7FFF, h: 0x7FFF})
+
+	for _, tc := range []struct {
+		name    string
+		data    []byte
+		picture int
+		offset  int64
+	}{
+		{"empty", nil, -1, 0},
+		{"signature", append([]byte("RLX"), data[3:]...), -1, 0},
+		{"table cut short", data[:headerSize+5], -1, 4},
+		{"picture outside", data[:second+2], 1, second},
+		{"row cut short", data[:second+int64(pictureHeaderSize)+1], 1, second + int64(pictureHeaderSize) + 1},
+		{"pixels cut short", data[:second-1], 0, second - 1},
+		{"row past width", wide, 0, int64(len(wide)) - 4},
+		{"picture too large", huge, 0, int64(headerSize) + 4},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewDecoder(bytes.NewReader(tc.data), testPalette())
+			var de *gsc.DecodeError
+			if !errors.As(err, &de) || !errors.Is(err, ErrFormat) {
+				t.Fatalf("err = %v, want a *gsc.DecodeError wrapping %v", err, ErrFormat)
+			}
+			if tc.picture >= 0 && de.Sprite != tc.picture {
+				t.Errorf("picture = %d, want %d", de.Sprite, tc.picture)
+			}
+			if de.Offset != tc.offset {
+				t.Errorf("offset = %d, want %d (%v)", de.Offset, tc.offset, err)
+			}
+		})
+	}
+}
+
+func FuzzDecoder(f *testing.F) {
+	f.Add(build(true, testPictures...))
+	f.Add(build(false, testPictures...))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		NewDecoder(bytes.NewReader(data), testPalette()[:16])
+	})
+}
@@ -0,0 +1,13 @@
+package rlc
+
+import (
+	"gitgub.com/cam-per/gossacks/gsc"
+)
+
+func init() {
+	gsc.RegisterFormat(gsc.Format{
+		Name:       "rlc",
+		Extensions: []string{".rlc"},
+		Sniff:      gsc.Magic(string(signature[:])),
+	})
+}
@@ -0,0 +1,168 @@
+// Package rlc decodes the run-length coded RLC pictures of the game.
+//
+// The package is experimental. The layout it reads was worked out without
+// a format specification and has only been checked against files written
+// by its own tests, not against files shipped with the game, so it may
+// change or reject genuine files.
+package rlc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+
+	"gitgub.com/cam-per/gossacks/gsc/gp"
+	"gitgub.com/cam-per/gossacks/gsc/internal/decode"
+)
+
+var (
+	ErrFormat = errors.New("rlc: invalid format")
+)
+
+var signature = [3]byte{'R', 'L', 'C'}
+
+// header starts an RLC file. A table of PicturesCount absolute uint32
+// picture offsets follows it.
+type header struct {
+	Sign          [4]byte
+	PicturesCount int16
+}
+
+// pictureHeader starts every picture. Height rows follow it, each a segment
+// count byte and that many (space, length) byte pairs. In colour files every
+// pair is followed by length palette indices; shadow files store the pairs
+// only.
+type pictureHeader struct {
+	Width, Height int16
+}
+
+type Picture struct {
+	image.Image
+	// Mask marks the pixels a picture of an ImageShadowRLC file darkens. It
+	// is nil for colour pictures.
+	Mask   *image.Alpha
+	offset int64
+}
+
+// maxPixelsPerByte bounds the area of a picture by the size of its file,
+// keeping forged headers from allocating gigabytes.
+const maxPixelsPerByte = 256
+
+var (
+	headerSize        = binary.Size(header{})
+	pictureHeaderSize = binary.Size(pictureHeader{})
+)
+
+// Detect reports whether data holds a colour or a shadow RLC file, or
+// gp.ImageInvalid when its pictures parse as neither. It is a guess: the
+// file does not record its type, so data is taken as colour pictures when
+// it parses as such and as shadow pictures otherwise.
+func Detect(data []byte) gp.ImageType {
+	offsets, err := pictureOffsets(data)
+	if err != nil {
+		return gp.ImageInvalid
+	}
+	for _, t := range []gp.ImageType{gp.ImageRLC, gp.ImageShadowRLC} {
+		if walkAll(data, offsets, t == gp.ImageRLC) {
+			return t
+		}
+	}
+	return gp.ImageInvalid
+}
+
+func walkAll(data []byte, offsets []uint32, pixels bool) bool {
+	for _, offset := range offsets {
+		if _, err := walkPicture(data, int64(offset), pixels, nil); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func pictureOffsets(data []byte) ([]uint32, error) {
+	if len(data) < headerSize || [3]byte(data[:3]) != signature {
+		return nil, formatError(0, "missing RLC signature")
+	}
+	count := int(int16(binary.LittleEndian.Uint16(data[4:])))
+	if count < 0 || headerSize+4*count > len(data) {
+		return nil, formatError(4, fmt.Sprintf("bad picture count %d", count))
+	}
+	offsets := make([]uint32, count)
+	for i := range offsets {
+		offsets[i] = binary.LittleEndian.Uint32(data[headerSize+4*i:])
+	}
+	return offsets, nil
+}
+
+// walkPicture parses the picture at offset and calls span, when not nil,
+// for every segment of n pixels starting at (x, y); with pixels set, p holds
+// their palette indices. It returns the picture size.
+func walkPicture(data []byte, offset int64, pixels bool, span func(x, y, n int, p []byte)) (image.Point, error) {
+	size, err := pictureSize(data, offset)
+	if err != nil {
+		return image.Point{}, err
+	}
+	w, h := size.X, size.Y
+
+	pos := int(offset) + pictureHeaderSize
+	next := func() (int, error) {
+		if pos >= len(data) {
+			return 0, formatError(int64(pos), "picture cut short")
+		}
+		pos++
+		return int(data[pos-1]), nil
+	}
+	for y := 0; y < h; y++ {
+		segments, err := next()
+		if err != nil {
+			return image.Point{}, err
+		}
+		x := 0
+		for s := 0; s < segments; s++ {
+			space, err := next()
+			if err != nil {
+				return image.Point{}, err
+			}
+			n, err := next()
+			if err != nil {
+				return image.Point{}, err
+			}
+			x += space
+			if x+n > w {
+				return image.Point{}, formatError(int64(pos-2), fmt.Sprintf("row %d runs past width %d", y, w))
+			}
+			var p []byte
+			if pixels {
+				if pos+n > len(data) {
+					return image.Point{}, formatError(int64(pos), "picture cut short")
+				}
+				p = data[pos : pos+n]
+				pos += n
+			}
+			if span != nil {
+				span(x, y, n, p)
+			}
+			x += n
+		}
+	}
+	return image.Pt(w, h), nil
+}
+
+func pictureSize(data []byte, offset int64) (image.Point, error) {
+	if offset < 0 || offset+int64(pictureHeaderSize) > int64(len(data)) {
+		return image.Point{}, formatError(offset, "picture outside the file")
+	}
+	w := int(int16(binary.LittleEndian.Uint16(data[offset:])))
+	h := int(int16(binary.LittleEndian.Uint16(data[offset+2:])))
+	// Rows take a byte at least, so h is bounded by the file; w is not.
+	if w < 0 || h < 0 || int64(w)*int64(h) > maxPixelsPerByte*int64(len(data)) {
+		return image.Point{}, formatError(offset, fmt.Sprintf("bad picture size %dx%d", w, h))
+	}
+	return image.Pt(w, h), nil
+}
+
+// formatError reports data at offset that does not follow the RLC layout.
+func formatError(offset int64, reason string) error {
+	return decode.NewError("rlc", reason, ErrFormat).At(offset)
+}
@@ -0,0 +1,111 @@
+package gsc
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+)
+
+type subContainer struct {
+	container *Container
+	dir       string
+}
+
+func (sub *subContainer) full(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return path.Join(sub.dir, name), nil
+}
+
+func (sub *subContainer) shorten(name string) string {
+	if name == sub.dir {
+		return "."
+	}
+	return strings.TrimPrefix(name, sub.dir+"/")
+}
+
+func (sub *subContainer) fixErr(err error) error {
+	if e, ok := err.(*fs.PathError); ok {
+		e.Path = sub.shorten(e.Path)
+	}
+	return err
+}
+
+func (sub *subContainer) Open(name string) (fs.File, error) {
+	full, err := sub.full("open", name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := sub.container.Open(full)
+	return f, sub.fixErr(err)
+}
+
+func (sub *subContainer) Stat(name string) (fs.FileInfo, error) {
+	full, err := sub.full("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := sub.container.Stat(full)
+	if err != nil {
+		return nil, sub.fixErr(err)
+	}
+	if name == "." {
+		info = &namedInfo{FileInfo: info, name: "."}
+	}
+	return info, nil
+}
+
+func (sub *subContainer) ReadDir(name string) ([]fs.DirEntry, error) {
+	full, err := sub.full("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := sub.container.ReadDir(full)
+	return entries, sub.fixErr(err)
+}
+
+func (sub *subContainer) ReadFile(name string) ([]byte, error) {
+	full, err := sub.full("read", name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := sub.container.ReadFile(full)
+	return data, sub.fixErr(err)
+}
+
+func (sub *subContainer) Glob(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	if pattern == "." {
+		return []string{"."}, nil
+	}
+	matches, err := sub.container.Glob(escapeMeta(sub.dir) + "/" + pattern)
+	for i, m := range matches {
+		matches[i] = sub.shorten(m)
+	}
+	return matches, err
+}
+
+func (sub *subContainer) Sub(dir string) (fs.FS, error) {
+	full, err := sub.full("sub", dir)
+	if err != nil {
+		return nil, err
+	}
+	fsys, err := sub.container.Sub(full)
+	return fsys, sub.fixErr(err)
+}
+
+// escapeMeta quotes the glob metacharacters of name so that it matches only
+// itself.
+func escapeMeta(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if strings.ContainsRune(`*?[\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,284 @@
+package gsc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"strings"
+
+	"gitgub.com/cam-per/gossacks/utils"
+	"golang.org/x/text/encoding/charmap"
+)
+
+const (
+	FlagObfuscated uint8 = 1
+)
+
+var (
+	ErrNameTooLong   = errors.New("gsc: name too long")
+	ErrDuplicateName = errors.New("gsc: duplicate name")
+	ErrTooLarge      = errors.New("gsc: archive too large")
+	ErrWriterClosed  = errors.New("gsc: writer closed")
+)
+
+// WriterOptions holds the archive header fields and the obfuscation policy
+// used by Writer. The zero value writes an empty descriptor, version 0 and
+// key 0, with no entry obfuscated.
+type WriterOptions struct {
+	Descriptor [6]byte
+	Version    uint16
+	Key        uint16
+	// Obfuscate reports whether the file stored under name should be
+	// XOR-obfuscated. It is consulted by AddFS and Build only.
+	Obfuscate func(name string) bool
+}
+
+type writerFile struct {
+	header header
+	size   int64
+	encode bool
+	open   func() (io.ReadCloser, error)
+}
+
+// Writer produces a .gsc archive. Entries are collected with the Add methods
+// and the archive is written by Close, because the FAT preceding the data
+// must know every entry size in advance. Entry data is laid out contiguously
+// in the order the entries were added.
+//
+// Entries added from files or bytes get a zero FAT Hash: how the game
+// computes that field is not known yet. AddContainer keeps the source hashes.
+type Writer struct {
+	w      io.Writer
+	opts   WriterOptions
+	files  []*writerFile
+	names  map[string]struct{}
+	size   int64
+	closed bool
+}
+
+func NewWriter(w io.Writer, opts *WriterOptions) *Writer {
+	writer := &Writer{
+		w:     w,
+		names: make(map[string]struct{}),
+	}
+	if opts != nil {
+		writer.opts = *opts
+	}
+	return writer
+}
+
+func Build(fsys fs.FS, w io.Writer, opts *WriterOptions) error {
+	writer := NewWriter(w, opts)
+	if err := writer.AddFS(fsys); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+func (writer *Writer) AddBytes(name string, data []byte, flags uint8) error {
+	return writer.add(name, int64(len(data)), flags, func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	})
+}
+
+func (writer *Writer) AddFile(fsys fs.FS, name string, flags uint8) error {
+	info, err := fs.Stat(fsys, name)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return &fs.PathError{Op: "add", Path: name, Err: errIsDir}
+	}
+	return writer.add(name, info.Size(), flags, func() (io.ReadCloser, error) {
+		return fsys.Open(name)
+	})
+}
+
+func (writer *Writer) AddFS(fsys fs.FS) error {
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		var flags uint8
+		if writer.opts.Obfuscate != nil && writer.opts.Obfuscate(name) {
+			flags = FlagObfuscated
+		}
+		return writer.AddFile(fsys, name, flags)
+	})
+}
+
+// AddContainer copies every entry of container verbatim: names, hashes,
+// flags and the stored (possibly obfuscated) bytes are kept as they are,
+// including duplicate names the source archive may carry. A name added
+// before is an ErrDuplicateName, and then no entry is added.
+func (writer *Writer) AddContainer(container *Container) error {
+	if writer.closed {
+		return ErrWriterClosed
+	}
+	for i := range container.fat {
+		if key := nameKey(container.fat[i].Name); writer.reserved(key) {
+			return fmt.Errorf("%w: %s", ErrDuplicateName, key)
+		}
+	}
+	for i := range container.fat {
+		h := container.fat[i]
+		writer.names[nameKey(h.Name)] = struct{}{}
+		offset := container.dataOffset + int64(h.Offset)
+		size := int64(h.Size)
+		writer.files = append(writer.files, &writerFile{
+			header: h,
+			size:   size,
+			open: func() (io.ReadCloser, error) {
+				return io.NopCloser(io.NewSectionReader(container.r, offset, size)), nil
+			},
+		})
+		writer.size += size
+	}
+	return nil
+}
+
+func (writer *Writer) Close() error {
+	if writer.closed {
+		return ErrWriterClosed
+	}
+	writer.closed = true
+
+	if writer.size > math.MaxUint32 || len(writer.files) > math.MaxUint32 {
+		return ErrTooLarge
+	}
+
+	h := archiveHeader{
+		Descriptor: writer.opts.Descriptor,
+		Version:    writer.opts.Version,
+		Key:        writer.opts.Key,
+		Entries:    uint32(len(writer.files)),
+	}
+	fat := make([]header, len(writer.files))
+	offset := int64(0)
+	for i, file := range writer.files {
+		fat[i] = file.header
+		fat[i].Offset = ^uint32(offset)
+		fat[i].Size = uint32(file.size)
+		offset += file.size
+	}
+
+	bw := bufio.NewWriter(writer.w)
+	if err := binary.Write(bw, binary.LittleEndian, &h); err != nil {
+		return err
+	}
+	if err := binary.Write(bw, binary.LittleEndian, fat); err != nil {
+		return err
+	}
+	for _, file := range writer.files {
+		if err := file.copyTo(bw); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func (writer *Writer) add(name string, size int64, flags uint8, open func() (io.ReadCloser, error)) error {
+	if writer.closed {
+		return ErrWriterClosed
+	}
+	raw, err := encodeName(name)
+	if err != nil {
+		return err
+	}
+	if err := writer.reserve(nameKey(raw)); err != nil {
+		return err
+	}
+	writer.files = append(writer.files, &writerFile{
+		header: header{Name: raw, Flags: flags},
+		size:   size,
+		encode: flags > 0,
+		open:   open,
+	})
+	writer.size += size
+	return nil
+}
+
+func (writer *Writer) reserved(key string) bool {
+	_, ok := writer.names[key]
+	return ok
+}
+
+func (writer *Writer) reserve(key string) error {
+	if writer.closed {
+		return ErrWriterClosed
+	}
+	if writer.reserved(key) {
+		return fmt.Errorf("%w: %s", ErrDuplicateName, key)
+	}
+	writer.names[key] = struct{}{}
+	return nil
+}
+
+func (file *writerFile) copyTo(w io.Writer) error {
+	r, err := file.open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if file.encode {
+		w = &obfuscatingWriter{w: w}
+	}
+	n, err := io.Copy(w, io.LimitReader(r, file.size))
+	if err != nil {
+		return err
+	}
+	if n != file.size {
+		return fmt.Errorf("gsc: %s: %w", nameKey(file.header.Name), io.ErrUnexpectedEOF)
+	}
+	return nil
+}
+
+type obfuscatingWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+func (ow *obfuscatingWriter) Write(p []byte) (int, error) {
+	ow.buf = append(ow.buf[:0], p...)
+	obfuscate(ow.buf)
+	return ow.w.Write(ow.buf)
+}
+
+func nameKey(raw [64]byte) string {
+	return strings.ToLower(utils.CString(raw[:]).Decode(charmap.CodePage866))
+}
+
+func encodeName(name string) ([64]byte, error) {
+	var raw [64]byte
+	name = strings.TrimPrefix(name, "/")
+	name = strings.ReplaceAll(name, "/", "\\")
+	buf, err := charmap.CodePage866.NewEncoder().Bytes([]byte(name))
+	if err != nil {
+		return raw, fmt.Errorf("gsc: %s: %w", name, err)
+	}
+	if len(buf) >= len(raw) {
+		return raw, fmt.Errorf("%w: %s", ErrNameTooLong, name)
+	}
+	copy(raw[:], buf)
+	return raw, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,111 @@
+package gsc_test
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"testing"
+
+	"gitgub.com/cam-per/gossacks/gsc"
+)
+
+func TestWriterRoundTrip(t *testing.T) {
+	opts := &gsc.WriterOptions{
+		Descriptor: [6]byte{'G', 'S', 'C', 'F', 'S', 0},
+		Version:    2,
+		Key:        0x1234,
+		Obfuscate:  obfuscateUnits,
+	}
+	var archive bytes.Buffer
+	if err := gsc.Build(testFiles, &archive, opts); err != nil {
+		t.Fatal(err)
+	}
+	container, err := gsc.NewContainer(bytes.NewReader(archive.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if container.Descriptor() != opts.Descriptor || container.Version() != opts.Version || container.Key() != opts.Key {
+		t.Fatalf("header = %q %d %#x", container.Descriptor(), container.Version(), container.Key())
+	}
+	if container.Len() != len(testFiles) {
+		t.Fatalf("Len = %d, want %d", container.Len(), len(testFiles))
+	}
+
+	var names []string
+	err = fs.WalkDir(container, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		names = append(names, name)
+		want, ok := testFiles[name]
+		if !ok {
+			t.Errorf("unexpected entry %q", name)
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() != int64(len(want.Data)) {
+			t.Errorf("%s: size = %d, want %d", name, info.Size(), len(want.Data))
+		}
+		if e := d.(gsc.Entry); e.Obfuscated() != obfuscateUnits(name) {
+			t.Errorf("%s: Obfuscated = %v", name, e.Obfuscated())
+		}
+		data, err := container.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(data, want.Data) {
+			t.Errorf("%s: contents = %q, want %q", name, data, want.Data)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != len(testFiles) {
+		t.Fatalf("walked %v", names)
+	}
+
+	var repacked bytes.Buffer
+	n, err := container.WriteTo(&repacked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(archive.Len()) || !bytes.Equal(repacked.Bytes(), archive.Bytes()) {
+		t.Fatalf("WriteTo wrote %d bytes differing from the %d-byte input", n, archive.Len())
+	}
+}
+
+func TestWriterAddContainerDuplicate(t *testing.T) {
+	container := newTestContainer(t, testFiles, nil)
+
+	var buf bytes.Buffer
+	writer := gsc.NewWriter(&buf, nil)
+	if err := writer.AddBytes("README.TXT", []byte("mine"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.AddContainer(container); !errors.Is(err, gsc.ErrDuplicateName) {
+		t.Fatalf("AddContainer: err = %v, want %v", err, gsc.ErrDuplicateName)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	written, err := gsc.NewContainer(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written.Len() != 1 {
+		t.Fatalf("failed AddContainer left %d entries, want 1", written.Len())
+	}
+
+	writer = gsc.NewWriter(&buf, nil)
+	if err := writer.AddContainer(container); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.AddBytes("gp/units/pik.gp", nil, 0); !errors.Is(err, gsc.ErrDuplicateName) {
+		t.Fatalf("AddBytes after AddContainer: err = %v, want %v", err, gsc.ErrDuplicateName)
+	}
+}